@@ -0,0 +1,97 @@
+package db
+
+import (
+	api "github.com/segmentq/protos-api-go"
+	"github.com/tidwall/buntdb"
+)
+
+// BatchLookup is a lookup run on an index as part of a batch
+type BatchLookup struct {
+	IndexName string
+	Lookup    *api.Lookup
+}
+
+// BatchResult holds the keys matched by a lookup of a batch, or the error which stopped it. Lookups which match
+// nothing fail with ErrLookupEmpty, as Next does. Cursor is set when a lookup run WithPage has another page.
+type BatchResult struct {
+	Keys   []string
+	Cursor string
+	Err    error
+}
+
+// LookupBatch runs many lookups in a single read transaction and returns the keys each matched, in the order of the
+// lookups. The options apply to every lookup. A lookup which fails does not stop the rest, its error is held by its
+// result.
+func (db *DB) LookupBatch(lookups []*BatchLookup, opts ...LookupOption) ([]*BatchResult, error) {
+	results := make([]*BatchResult, len(lookups))
+
+	err := db.engine.View(func(tx *buntdb.Tx) error {
+		// Index ids are resolved once for each index of the batch
+		indexIds := make(map[string]string)
+
+		for n, lookup := range lookups {
+			results[n] = &BatchResult{}
+
+			if _, ok := db.idx[lookup.IndexName]; !ok {
+				results[n].Err = ErrIndexUnknown
+				continue
+			}
+
+			indexId, ok := indexIds[lookup.IndexName]
+			if !ok {
+				var err error
+				if indexId, err = tx.Get(idxKey(idxById, lookup.IndexName), true); err != nil {
+					return ErrInternalDBError
+				}
+				indexIds[lookup.IndexName] = indexId
+			}
+
+			results[n].Err = db.batchLookup(tx, indexId, lookup, results[n], opts...)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// LookupBatch runs many lookups in a single read transaction and returns the keys each matched, in the order of the
+// lookups. The options apply to every lookup. A lookup which fails does not stop the rest, its error is held by its
+// result.
+func (i *Index) LookupBatch(lookups []*api.Lookup, opts ...LookupOption) ([]*BatchResult, error) {
+	batch := make([]*BatchLookup, 0, len(lookups))
+	for _, lookup := range lookups {
+		batch = append(batch, &BatchLookup{IndexName: i.definition.Name, Lookup: lookup})
+	}
+
+	return i.db.LookupBatch(batch, opts...)
+}
+
+// batchLookup runs a lookup of a batch in the transaction and adds its matches to the result
+func (db *DB) batchLookup(tx *buntdb.Tx, indexId string, lookup *BatchLookup, batch *BatchResult,
+	opts ...LookupOption) error {
+	it := newLookup(db, nil, lookup.Lookup, true, opts...).RunOnIndex(lookup.IndexName)
+	if it.err != nil {
+		return it.err
+	}
+
+	err := it.run(tx, indexId, func(r result) bool {
+		batch.Keys = append(batch.Keys, r.key)
+		if r.cursor != "" {
+			batch.Cursor = r.cursor
+		}
+		return true
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if len(batch.Keys) == 0 {
+		return ErrLookupEmpty
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	api "github.com/segmentq/protos-api-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestIndex_LookupBatch(t *testing.T) {
+	d := testNewDB(t)
+	index := testActiveIndex(t, d, 30)
+
+	lookups := []*api.Lookup{
+		{Fields: []*api.LookupField{boolLookupField("active", false)}},
+		{Fields: []*api.LookupField{boolLookupField("active", false), stringLookupField("country", "GB")}},
+		{Fields: []*api.LookupField{stringLookupField("country", "US")}},
+		{Fields: []*api.LookupField{stringLookupField("region", "EU")}},
+		{Fields: []*api.LookupField{stringLookupField("name", "segment-7")}},
+	}
+
+	tests := []struct {
+		name    string
+		opts    []LookupOption
+		want    [][]string
+		wantErr []error
+	}{
+		{
+			name:    "unordered",
+			want:    [][]string{{"segment-0", "segment-10", "segment-20"}, {"segment-0"}, nil, nil, {"segment-7"}},
+			wantErr: []error{nil, nil, ErrLookupEmpty, ErrFieldUnknown, nil},
+		},
+		{
+			name:    "sorted",
+			opts:    []LookupOption{WithSort("", true)},
+			want:    [][]string{{"segment-20", "segment-10", "segment-0"}, {"segment-0"}, nil, nil, {"segment-7"}},
+			wantErr: []error{nil, nil, ErrLookupEmpty, ErrFieldUnknown, nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := index.LookupBatch(lookups, tt.opts...)
+			if !assert.NoError(t, err) || !assert.Len(t, results, len(lookups)) {
+				return
+			}
+
+			for n, result := range results {
+				if tt.wantErr[n] != nil {
+					assert.ErrorIs(t, result.Err, tt.wantErr[n])
+				} else {
+					assert.NoError(t, result.Err)
+				}
+				if tt.opts == nil {
+					assert.ElementsMatch(t, tt.want[n], result.Keys)
+				} else {
+					assert.Equal(t, tt.want[n], result.Keys)
+				}
+			}
+		})
+	}
+}
+
+func TestDB_LookupBatch(t *testing.T) {
+	d := testNewDB(t)
+	testActiveIndex(t, d, 30)
+	testPriorityIndex(t, d, 10)
+
+	results, err := d.LookupBatch([]*BatchLookup{
+		{IndexName: "active", Lookup: &api.Lookup{Fields: []*api.LookupField{stringLookupField("name", "segment-7")}}},
+		{IndexName: "priorities", Lookup: &api.Lookup{Fields: []*api.LookupField{boolLookupField("active", false)}}},
+		{IndexName: "unknown", Lookup: &api.Lookup{}},
+		{IndexName: "priorities", Lookup: &api.Lookup{Fields: []*api.LookupField{intLookupField("priority", 4)}}},
+	}, WithPage(1, ""))
+	if !assert.NoError(t, err) || !assert.Len(t, results, 4) {
+		return
+	}
+
+	assert.Equal(t, []string{"segment-7"}, results[0].Keys)
+	assert.Empty(t, results[0].Cursor)
+	assert.Equal(t, []string{"segment-03"}, results[1].Keys)
+	assert.ErrorIs(t, results[2].Err, ErrIndexUnknown)
+
+	// Paged lookups return the cursor of their next page
+	assert.Equal(t, []string{"segment-04"}, results[3].Keys)
+	if assert.NotEmpty(t, results[3].Cursor) {
+		it, err := d.Lookup("priorities", &api.Lookup{Fields: []*api.LookupField{intLookupField("priority", 4)}},
+			WithPage(1, results[3].Cursor))
+		if assert.NoError(t, err) {
+			key, err := it.Next(nil)
+			assert.NoError(t, err)
+			assert.Equal(t, "segment-09", key)
+		}
+	}
+}
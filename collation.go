@@ -0,0 +1,68 @@
+package db
+
+import (
+	api "github.com/segmentq/protos-api-go"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+	"strings"
+	"unicode"
+)
+
+// Collation controls how the values of a string field are compared, the same rules are applied to segment and
+// lookup values so e.g. "London", "london" and " LONDON " can be made to match. Stored segments keep the original
+// value.
+type Collation struct {
+	// FoldCase compares values without regard to case
+	FoldCase bool `json:"fold_case,omitempty"`
+
+	// Normalize compares values in Unicode NFC, so composed and decomposed characters match
+	Normalize bool `json:"normalize,omitempty"`
+
+	// Trim ignores leading and trailing whitespace
+	Trim bool `json:"trim,omitempty"`
+
+	// StripAccents ignores diacritics, so "café" matches "cafe"
+	StripAccents bool `json:"strip_accents,omitempty"`
+}
+
+// isZero reports whether no collation rules are set
+func (c *Collation) isZero() bool {
+	return c == nil || *c == Collation{}
+}
+
+// apply converts a value into the form used by the field index
+func (c *Collation) apply(value string) string {
+	if c.isZero() {
+		return value
+	}
+
+	if c.Trim {
+		value = strings.TrimSpace(value)
+	}
+
+	if c.StripAccents {
+		stripped, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), value)
+		if err == nil {
+			value = stripped
+		}
+	} else if c.Normalize {
+		value = norm.NFC.String(value)
+	}
+
+	if c.FoldCase {
+		value = cases.Fold().String(value)
+	}
+
+	return value
+}
+
+// isStringScalar reports whether the field holds plain strings, the only fields a collation applies to
+func isStringScalar(definition *api.FieldDefinition) bool {
+	if _, ok := definition.GetDataType().(*api.FieldDefinition_Scalar); !ok {
+		return false
+	}
+	scalar := definition.GetScalar()
+	return scalar == api.ScalarType_DATA_TYPE_STRING || scalar == api.ScalarType_DATA_TYPE_UNDEFINED
+}
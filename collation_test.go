@@ -0,0 +1,112 @@
+package db
+
+import (
+	"fmt"
+	api "github.com/segmentq/protos-api-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCollation_apply(t *testing.T) {
+	tests := []struct {
+		name      string
+		collation *Collation
+		value     string
+		want      string
+	}{
+		{name: "no collation", value: " London ", want: " London "},
+		{name: "fold case", collation: &Collation{FoldCase: true}, value: "LONDON", want: "london"},
+		{name: "trim", collation: &Collation{Trim: true}, value: "\t London \n", want: "London"},
+		{name: "normalize", collation: &Collation{Normalize: true}, value: "Café", want: "Café"},
+		{name: "strip accents", collation: &Collation{StripAccents: true}, value: "Café Zürich", want: "Cafe Zurich"},
+		{
+			name:      "all rules",
+			collation: &Collation{FoldCase: true, Normalize: true, Trim: true, StripAccents: true},
+			value:     "  SÃO Paulo ",
+			want:      "sao paulo",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equalf(t, tt.want, tt.collation.apply(tt.value), "apply(%q)", tt.value)
+		})
+	}
+}
+
+func TestDB_Lookup_Collation(t *testing.T) {
+	d := testNewDB(t)
+	index, err := d.CreateIndexWithOptions(&api.IndexDefinition{
+		Name: "cities",
+		Fields: []*api.FieldDefinition{
+			{
+				Name:      "name",
+				DataType:  &api.FieldDefinition_Scalar{Scalar: api.ScalarType_DATA_TYPE_STRING},
+				IsPrimary: true,
+			},
+			scalarField("city", api.ScalarType_DATA_TYPE_STRING),
+		},
+	}, map[string]*FieldOptions{
+		"city": {Collation: &Collation{FoldCase: true, Trim: true, StripAccents: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	segment := getSingleFieldSegment("travellers")
+	segment.Fields = append(segment.Fields, &api.SegmentField{
+		Name:  "city",
+		Value: &api.SegmentField_StringValue{StringValue: &api.SegmentFieldString{Value: "São Paulo"}},
+	})
+	_, err = index.InsertSegment(segment)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, city := range []string{"São Paulo", "SAO PAULO", " sao paulo "} {
+		t.Run(city, func(t *testing.T) {
+			it, err := index.Lookup(&api.Lookup{
+				Fields: []*api.LookupField{
+					{
+						Name:  "city",
+						Value: &api.LookupField_StringValue{StringValue: &api.SegmentFieldString{Value: city}},
+					},
+				},
+			})
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equalf(t, []string{"travellers"}, testCollectKeys(t, it), fmt.Sprintf("Lookup(%s)", city))
+		})
+	}
+
+	// The stored segment keeps the original value
+	stored, err := index.GetSegmentByKey("travellers")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "São Paulo", stored.Proto().Fields[1].GetStringValue().GetValue())
+}
+
+func TestDB_CreateIndexWithOptions_Collation(t *testing.T) {
+	tests := []struct {
+		name    string
+		options map[string]*FieldOptions
+	}{
+		{name: "not a string", options: map[string]*FieldOptions{"age": {Collation: &Collation{FoldCase: true}}}},
+		{name: "primary", options: map[string]*FieldOptions{"name": {Collation: &Collation{FoldCase: true}}}},
+		{
+			name:    "unique",
+			options: map[string]*FieldOptions{"external_id": {Unique: true, Collation: &Collation{FoldCase: true}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := testNewDB(t)
+			index := getAudienceIndex("audiences")
+			index.Fields = append(index.Fields, scalarField("age", api.ScalarType_DATA_TYPE_INT))
+
+			_, err := d.CreateIndexWithOptions(index, tt.options)
+			assert.ErrorIs(t, err, ErrInvalidFieldOptions)
+		})
+	}
+}
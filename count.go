@@ -0,0 +1,76 @@
+package db
+
+import (
+	api "github.com/segmentq/protos-api-go"
+	"github.com/tidwall/buntdb"
+)
+
+// Count returns the number of segments matching the lookup, without reading the segments
+func (db *DB) Count(indexName string, lookup *api.Lookup, opts ...LookupOption) (int64, error) {
+	return db.count(indexName, lookup, 0, opts...)
+}
+
+// LookupExists reports whether any segment matches the lookup, it stops at the first match
+func (db *DB) LookupExists(indexName string, lookup *api.Lookup, opts ...LookupOption) (bool, error) {
+	count, err := db.count(indexName, lookup, 1, opts...)
+	return count > 0, err
+}
+
+// Count returns the number of segments matching the lookup, without reading the segments
+func (i *Index) Count(lookup *api.Lookup, opts ...LookupOption) (int64, error) {
+	return i.db.count(i.definition.Name, lookup, 0, opts...)
+}
+
+// LookupExists reports whether any segment matches the lookup, it stops at the first match
+func (i *Index) LookupExists(lookup *api.Lookup, opts ...LookupOption) (bool, error) {
+	count, err := i.db.count(i.definition.Name, lookup, 1, opts...)
+	return count > 0, err
+}
+
+// count counts the matches of a lookup up to the limit, a limit of 0 counts every match. Options which sort or page
+// results do not change the count.
+func (db *DB) count(indexName string, lookup *api.Lookup, limit int64, opts ...LookupOption) (int64, error) {
+	if _, ok := db.idx[indexName]; !ok {
+		return 0, ErrIndexUnknown
+	}
+
+	t := &Iterator{idx: indexName, l: newLookup(db, nil, lookup, true, opts...)}
+
+	var count int64
+	err := db.engine.View(func(tx *buntdb.Tx) error {
+		indexId, err := tx.Get(idxKey(idxById, indexName), true)
+		if err != nil {
+			return ErrInternalDBError
+		}
+
+		e := newEvaluator(t, tx, indexId)
+		query := t.l.tree()
+		if err = prepare(e, query); err != nil {
+			return err
+		}
+
+		var testErr error
+		err = query.candidates(e, func(key string) bool {
+			ok, err := query.test(e, key)
+			if err != nil {
+				testErr = err
+				return false
+			}
+			if ok {
+				count++
+			}
+			return limit <= 0 || count < limit
+		})
+
+		if err != nil {
+			return err
+		}
+		return testErr
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
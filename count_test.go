@@ -0,0 +1,85 @@
+package db
+
+import (
+	api "github.com/segmentq/protos-api-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestIndex_Count(t *testing.T) {
+	d := testNewDB(t)
+	index := testActiveIndex(t, d, 30)
+
+	tests := []struct {
+		name    string
+		lookup  *api.Lookup
+		opts    []LookupOption
+		want    int64
+		exists  bool
+		wantErr error
+	}{
+		{
+			name:   "common value",
+			lookup: &api.Lookup{Fields: []*api.LookupField{boolLookupField("active", true)}},
+			want:   27,
+			exists: true,
+		},
+		{
+			name: "fields combined",
+			lookup: &api.Lookup{Fields: []*api.LookupField{
+				boolLookupField("active", false),
+				stringLookupField("country", "GB"),
+			}},
+			want:   1,
+			exists: true,
+		},
+		{
+			name:   "query",
+			lookup: &api.Lookup{},
+			opts:   []LookupOption{WithQuery(Not(Match(stringLookupField("country", "GB"))))},
+			want:   20,
+			exists: true,
+		},
+		{
+			name:   "operator",
+			lookup: &api.Lookup{Fields: []*api.LookupField{stringLookupField("name", "segment-1")}},
+			opts:   []LookupOption{WithOperator("name", OperatorPrefix)},
+			want:   11,
+			exists: true,
+		},
+		{
+			name:   "no match",
+			lookup: &api.Lookup{Fields: []*api.LookupField{stringLookupField("country", "US")}},
+		},
+		{
+			name:    "unknown field",
+			lookup:  &api.Lookup{Fields: []*api.LookupField{stringLookupField("region", "EU")}},
+			wantErr: ErrFieldUnknown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, err := index.Count(tt.lookup, tt.opts...)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, count)
+			}
+
+			exists, err := d.LookupExists(index.definition.Name, tt.lookup, tt.opts...)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, tt.exists, exists)
+			}
+		})
+	}
+
+	_, err := d.Count("unknown", &api.Lookup{})
+	assert.ErrorIs(t, err, ErrIndexUnknown)
+
+	// The index itself still exists
+	exists, err := index.Exists()
+	assert.NoError(t, err)
+	assert.True(t, exists)
+}
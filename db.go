@@ -15,14 +15,18 @@ const (
 	idxById             = "#"
 	idxByIdPattern      = idxById + idxSep + wildcard
 	fieldDefByIdx       = "%"
+	fieldOptsByIdx      = "&"
 	segmentByPrimaryKey = "$"
+	unconstrainedFields = "~"
+	fieldStatsByIdx     = "!"
 )
 
 type DB struct {
-	ctx    context.Context
-	engine *buntdb.DB
-	idx    map[string]*api.IndexDefinition            // All index definitions in memory
-	fields map[string]map[string]*api.FieldDefinition // Field definitions by index and field
+	ctx     context.Context
+	engine  *buntdb.DB
+	idx     map[string]*api.IndexDefinition            // All index definitions in memory
+	fields  map[string]map[string]*api.FieldDefinition // Field definitions by index and field
+	options map[string]map[string]*FieldOptions        // Field options by index and field
 }
 
 type DurabilityProfile int
@@ -118,7 +122,8 @@ func (db *DB) init() error {
 		return ErrInternalDBError
 	}
 
-	return nil
+	// The engine does not persist its indexes, those of a database opened from a file are created again
+	return db.restoreIndexes()
 }
 
 type Key struct {
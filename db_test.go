@@ -14,6 +14,21 @@ func testNewDB(t *testing.T) *DB {
 	return db
 }
 
+// testReopenDB opens a database stored in a file, closing the one already open on it
+func testReopenDB(t *testing.T, path string, open *DB) *DB {
+	if open != nil {
+		if err := open.engine.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, err := NewDBWithConfig(context.Background(), &ClientConfig{Path: path, Durability: Disk})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
 func TestKey_FieldNameAtIndex(t *testing.T) {
 	type fields struct {
 		parts     []string
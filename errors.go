@@ -4,16 +4,25 @@ import "errors"
 
 var (
 	// ErrInternalDBError is used when the internal database returns an error
-	ErrInternalDBError   = errors.New("internal database returned an error")
-	ErrIndexExists       = errors.New("index already exists")
-	ErrIndexUnknown      = errors.New("index is unknown")
-	ErrUnknownDataType   = errors.New("data type not supported")
-	ErrFieldUnknown      = errors.New("field not part of the index")
-	ErrIndexNotSet       = errors.New("index must be set before lookup")
-	ErrLookupFailure     = errors.New("could not complete lookup")
-	ErrLookupEmpty       = errors.New("no results for lookup")
-	ErrSegmentMissing    = errors.New("segment was not available for lookup")
-	ErrSegmentNotFound   = errors.New("segment does not exist")
-	ErrMarshallingFailed = errors.New("marshalling failed")
-	ErrPrimaryKeyMissing = errors.New("index is missing a primary key")
+	ErrInternalDBError     = errors.New("internal database returned an error")
+	ErrIndexExists         = errors.New("index already exists")
+	ErrIndexUnknown        = errors.New("index is unknown")
+	ErrUnknownDataType     = errors.New("data type not supported")
+	ErrFieldUnknown        = errors.New("field not part of the index")
+	ErrIndexNotSet         = errors.New("index must be set before lookup")
+	ErrLookupFailure       = errors.New("could not complete lookup")
+	ErrLookupEmpty         = errors.New("no results for lookup")
+	ErrSegmentMissing      = errors.New("segment was not available for lookup")
+	ErrSegmentNotFound     = errors.New("segment does not exist")
+	ErrMarshallingFailed   = errors.New("marshalling failed")
+	ErrPrimaryKeyMissing   = errors.New("index is missing a primary key")
+	ErrUniqueConflict      = errors.New("unique value is held by another segment")
+	ErrTypeMismatch        = errors.New("value does not match the field type")
+	ErrValueOutOfRange     = errors.New("value is out of range for the field type")
+	ErrRequiredMissing     = errors.New("required field is missing")
+	ErrFieldNotIndexed     = errors.New("field is not indexed and cannot be used in a lookup")
+	ErrInvalidFieldOptions = errors.New("field options are not valid for the field")
+	ErrInvalidOperator     = errors.New("lookup operator is not valid for the field")
+	ErrInvalidCursor       = errors.New("cursor is not valid for the lookup or listing")
+	ErrInvalidSort         = errors.New("lookup cannot be sorted by the field")
 )
@@ -0,0 +1,147 @@
+package db
+
+import (
+	api "github.com/segmentq/protos-api-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDB_Lookup_Exclusions(t *testing.T) {
+	d := testNewDB(t)
+	index, err := d.CreateIndexWithOptions(&api.IndexDefinition{
+		Name: "audiences",
+		Fields: []*api.FieldDefinition{
+			{
+				Name:      "name",
+				DataType:  &api.FieldDefinition_Scalar{Scalar: api.ScalarType_DATA_TYPE_STRING},
+				IsPrimary: true,
+			},
+			geoField("age", api.GeoType_DATA_TYPE_RANGE_INT),
+			geoField("excluded_age", api.GeoType_DATA_TYPE_RANGE_INT),
+			scalarField("postcode", api.ScalarType_DATA_TYPE_STRING),
+			scalarField("excluded_postcode", api.ScalarType_DATA_TYPE_STRING),
+		},
+	}, map[string]*FieldOptions{
+		"excluded_age":      {Excludes: "age"},
+		"excluded_postcode": {Excludes: "postcode"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ageRange := func(name string, min, max int64) *api.SegmentField {
+		return &api.SegmentField{
+			Name:  name,
+			Value: &api.SegmentField_RangeIntValue{RangeIntValue: &api.SegmentFieldRangeInt{Min: min, Max: max}},
+		}
+	}
+
+	segments := map[string][]*api.SegmentField{
+		"adults-outside-london": {
+			ageRange("age", 18, 65),
+			{
+				Name: "excluded_postcode",
+				Value: &api.SegmentField_RepeatedStringValue{
+					RepeatedStringValue: &api.SegmentFieldRepeatedString{Value: []string{"E1", "N1"}},
+				},
+			},
+		},
+		"adults-not-students-in-e1": {
+			ageRange("age", 18, 65),
+			ageRange("excluded_age", 18, 22),
+			stringSegmentField("postcode", "E1"),
+		},
+	}
+	for name, fields := range segments {
+		segment := getSingleFieldSegment(name)
+		segment.Fields = append(segment.Fields, fields...)
+		if _, err = index.InsertSegment(segment); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	age := func(value int64) *api.LookupField {
+		return &api.LookupField{
+			Name:  "age",
+			Value: &api.LookupField_RangeIntValue{RangeIntValue: &api.SegmentFieldRangeInt{Min: value, Max: value}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		fields []*api.LookupField
+		want   []string
+	}{
+		{
+			name:   "postcode outside the exclusions",
+			fields: []*api.LookupField{age(30), stringLookupField("postcode", "SW1")},
+			want:   []string{"adults-outside-london"},
+		},
+		{
+			name:   "postcode hits an exclusion",
+			fields: []*api.LookupField{age(30), stringLookupField("postcode", "N1")},
+			want:   []string{},
+		},
+		{
+			name:   "included postcode",
+			fields: []*api.LookupField{age(30), stringLookupField("postcode", "E1")},
+			want:   []string{"adults-not-students-in-e1"},
+		},
+		{
+			name:   "age hits an excluded range",
+			fields: []*api.LookupField{age(20)},
+			want:   []string{"adults-outside-london"},
+		},
+		{
+			name:   "age outside the excluded range",
+			fields: []*api.LookupField{age(40)},
+			want:   []string{"adults-outside-london", "adults-not-students-in-e1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it, err := index.Lookup(&api.Lookup{Fields: tt.fields})
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.ElementsMatch(t, tt.want, testCollectKeys(t, it))
+		})
+	}
+}
+
+func TestDB_CreateIndexWithOptions_Excludes(t *testing.T) {
+	tests := []struct {
+		name    string
+		options map[string]*FieldOptions
+		wantErr error
+	}{
+		{
+			name:    "unknown field",
+			options: map[string]*FieldOptions{"excluded": {Excludes: "region"}},
+			wantErr: ErrFieldUnknown,
+		},
+		{
+			name:    "different type",
+			options: map[string]*FieldOptions{"excluded": {Excludes: "age"}},
+			wantErr: ErrInvalidFieldOptions,
+		},
+		{
+			name:    "itself",
+			options: map[string]*FieldOptions{"excluded": {Excludes: "excluded"}},
+			wantErr: ErrInvalidFieldOptions,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := testNewDB(t)
+			definition := getAudienceIndex("audiences")
+			definition.Fields = append(definition.Fields,
+				scalarField("age", api.ScalarType_DATA_TYPE_INT),
+				scalarField("excluded", api.ScalarType_DATA_TYPE_STRING),
+			)
+
+			_, err := d.CreateIndexWithOptions(definition, tt.options)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
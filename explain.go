@@ -0,0 +1,236 @@
+package db
+
+import (
+	"fmt"
+	api "github.com/segmentq/protos-api-go"
+	"github.com/tidwall/buntdb"
+	"strings"
+	"time"
+)
+
+// Explanation describes how a lookup was planned and what each part of it matched
+type Explanation struct {
+	// Query is the query tree of the lookup, its fields ANDed with any query set by WithQuery
+	Query string
+
+	// Steps are the queries ANDed by the lookup in the order they were planned, the first finds the candidates and
+	// each candidate is tested against the steps in turn until one rejects it
+	Steps []*ExplainStep
+
+	// Scanned is the number of engine index entries visited to find the candidates
+	Scanned int64
+
+	// Candidates is the number of segments tested against the steps
+	Candidates int64
+
+	// Matches is the number of segments the lookup returns
+	Matches int64
+
+	// ScanDuration is the time spent finding candidates, Duration the time spent on the whole lookup
+	ScanDuration time.Duration
+	Duration     time.Duration
+}
+
+// ExplainStep describes one query ANDed by a lookup
+type ExplainStep struct {
+	// Query is the query of the step, Field and Operator are set when it matches a lookup field
+	Query    string
+	Field    string
+	Operator string
+
+	// Index is the engine index of the field and Scan the scans used on it, such as AscendEqual or Intersects,
+	// when the step finds the candidates. Only the first step does, the rest test each candidate.
+	Index string
+	Scan  string
+
+	// Cost is the number of segments the planner estimated the step matches
+	Cost int64
+
+	// Tested is the number of candidates the step tested and Remaining the number which matched it
+	Tested    int64
+	Remaining int64
+
+	// Duration is the time spent testing candidates
+	Duration time.Duration
+}
+
+// String formats the explanation with a line for each step
+func (x *Explanation) String() string {
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "%s: %d scanned, %d candidates, %d matches in %s\n", x.Query, x.Scanned,
+		x.Candidates, x.Matches, x.Duration)
+	for n, step := range x.Steps {
+		_, _ = fmt.Fprintf(&b, "%d. %s cost %d", n+1, step.Query, step.Cost)
+		if step.Scan != "" {
+			_, _ = fmt.Fprintf(&b, ", %s on %s", step.Scan, step.Index)
+		}
+		_, _ = fmt.Fprintf(&b, ": %d tested, %d remaining in %s\n", step.Tested, step.Remaining, step.Duration)
+	}
+	return b.String()
+}
+
+// Explain runs the lookup and describes how it was planned, how many candidates were found and how many were left
+// after each step, so a lookup which returns nothing shows which of its fields eliminated the candidates
+func (db *DB) Explain(indexName string, lookup *api.Lookup, opts ...LookupOption) (*Explanation, error) {
+	if _, ok := db.idx[indexName]; !ok {
+		return nil, ErrIndexUnknown
+	}
+
+	start := time.Now()
+	t := &Iterator{idx: indexName, l: newLookup(db, nil, lookup, true, opts...)}
+	query := t.l.tree()
+	x := &Explanation{Query: query.String()}
+
+	err := db.engine.View(func(tx *buntdb.Tx) error {
+		indexId, err := tx.Get(idxKey(idxById, indexName), true)
+		if err != nil {
+			return ErrInternalDBError
+		}
+
+		e := newEvaluator(t, tx, indexId)
+		if err = prepare(e, query); err != nil {
+			return err
+		}
+
+		steps := t.explainSteps(e, query)
+		for _, step := range steps {
+			x.Steps = append(x.Steps, step.ExplainStep)
+		}
+
+		var testErr error
+		var tested time.Duration
+		scanStart := time.Now()
+		err = query.candidates(e, func(key string) bool {
+			x.Candidates++
+
+			for _, step := range steps {
+				stepStart := time.Now()
+				ok, err := step.query.test(e, key)
+				step.Duration += time.Since(stepStart)
+				tested += time.Since(stepStart)
+
+				if err != nil {
+					testErr = err
+					return false
+				}
+
+				step.Tested++
+				if !ok {
+					return true
+				}
+				step.Remaining++
+			}
+
+			if len(steps) > 0 {
+				x.Matches++
+			}
+			return true
+		})
+
+		x.Scanned = e.scanned
+		x.ScanDuration = time.Since(scanStart) - tested
+		if err != nil {
+			return err
+		}
+		return testErr
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	x.Duration = time.Since(start)
+	return x, nil
+}
+
+// Explain runs the lookup and describes how it was planned, how many candidates were found and how many were left
+// after each step, so a lookup which returns nothing shows which of its fields eliminated the candidates
+func (i *Index) Explain(lookup *api.Lookup, opts ...LookupOption) (*Explanation, error) {
+	return i.db.Explain(i.definition.Name, lookup, opts...)
+}
+
+// explainStep is a step of an explanation with the query it tests
+type explainStep struct {
+	*ExplainStep
+	query Query
+}
+
+// explainSteps returns the steps of the AND of a lookup in the order they are planned, negations last. Other
+// queries, such as those of scored lookups, are a single step.
+func (t *Iterator) explainSteps(e *evaluator, query Query) []*explainStep {
+	and, ok := query.(*andQuery)
+	if !ok {
+		and = &andQuery{queries: []Query{query}}
+	}
+
+	included := make([]Query, 0, len(and.queries))
+	excluded := make([]Query, 0)
+	for _, q := range and.queries {
+		if _, ok := q.(*notQuery); ok {
+			excluded = append(excluded, q)
+			continue
+		}
+		included = append(included, q)
+	}
+
+	planned, costs := plan(e, included)
+	for _, q := range excluded {
+		planned = append(planned, q)
+		costs = append(costs, q.cost(e))
+	}
+
+	steps := make([]*explainStep, 0, len(planned))
+	for n, q := range planned {
+		step := &explainStep{ExplainStep: &ExplainStep{Query: q.String(), Cost: costs[n]}, query: q}
+
+		if match, ok := q.(*matchQuery); ok {
+			operator := match.resolve(e)
+			step.Field = match.field.Name
+			step.Operator = operator.String()
+
+			// Only the first step finds the candidates
+			if n == 0 {
+				step.Index = idxKey(e.indexId, match.field.Name)
+				step.Scan = t.scanName(match.field, operator)
+			}
+		}
+
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+// scanName names the engine scans scanField uses for a lookup field
+func (t *Iterator) scanName(field *api.LookupField, operator Operator) string {
+	definition, field, options, err := t.prepareField(field, operator)
+	if err != nil {
+		return ""
+	}
+
+	name := "AscendEqual"
+	switch operator {
+	case OperatorPrefix, OperatorWildcard, OperatorRegex, OperatorGreaterOrEqual:
+		name = "AscendGreaterOrEqual"
+	case OperatorLess:
+		name = "AscendLessThan"
+	case OperatorLessOrEqual:
+		name = "AscendLessThan+AscendEqual"
+	case OperatorGreater:
+		name = "DescendGreaterThan"
+	case OperatorBetween:
+		name = "AscendRange+AscendEqual"
+	case OperatorNotEqual:
+		name = "Ascend"
+	default:
+		if _, isRange, _ := scanRanges(definition, field, options); isRange {
+			name = "AscendRange"
+		} else if isGeoLookupField(field) || isSpatialField(definition, options.fieldType()) {
+			name = "Intersects"
+		}
+	}
+
+	if options.missingMatchesAny() || t.l.db.excludedBy(t.idx, field.Name) != "" {
+		name += "+AscendEqual(" + unconstrainedFields + ")"
+	}
+	return name
+}
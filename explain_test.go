@@ -0,0 +1,63 @@
+package db
+
+import (
+	api "github.com/segmentq/protos-api-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestIndex_Explain(t *testing.T) {
+	d := testNewDB(t)
+	index := testActiveIndex(t, d, 30)
+
+	x, err := index.Explain(&api.Lookup{Fields: []*api.LookupField{
+		stringLookupField("country", "GB"),
+		boolLookupField("active", false),
+	}}, WithQuery(Not(Match(stringLookupField("name", "segment-20")))))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, int64(3), x.Scanned)
+	assert.Equal(t, int64(3), x.Candidates)
+	assert.Equal(t, int64(1), x.Matches)
+
+	// The inactive segments are the fewest so they are the candidates, negations are tested last
+	if !assert.Len(t, x.Steps, 3) {
+		return
+	}
+	assert.Equal(t, "active", x.Steps[0].Field)
+	assert.Equal(t, "AscendEqual", x.Steps[0].Scan)
+	assert.Equal(t, []string{"", ""}, []string{x.Steps[1].Index, x.Steps[1].Scan})
+	assert.Equal(t, []int64{3, 10}, []int64{x.Steps[0].Cost, x.Steps[1].Cost})
+	assert.Equal(t, []int64{3, 3, 1}, []int64{x.Steps[0].Tested, x.Steps[1].Tested, x.Steps[2].Tested})
+	assert.Equal(t, []int64{3, 1, 1}, []int64{x.Steps[0].Remaining, x.Steps[1].Remaining, x.Steps[2].Remaining})
+	assert.Equal(t, "", x.Steps[2].Field)
+	assert.Contains(t, x.String(), "1 matches")
+}
+
+func TestIndex_Explain_Empty(t *testing.T) {
+	d := testNewDB(t)
+	index := testActiveIndex(t, d, 30)
+
+	// The field which eliminated every candidate is the one with none remaining
+	x, err := index.Explain(&api.Lookup{Fields: []*api.LookupField{
+		boolLookupField("active", false),
+		stringLookupField("name", "segment-3"),
+	}}, WithOperator("name", OperatorPrefix))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, int64(0), x.Matches)
+	if !assert.Len(t, x.Steps, 2) {
+		return
+	}
+	assert.Equal(t, "prefix", x.Steps[1].Operator)
+	assert.Empty(t, x.Steps[1].Scan, "only the first step scans")
+	assert.Equal(t, int64(3), x.Steps[1].Tested)
+	assert.Equal(t, int64(0), x.Steps[1].Remaining)
+
+	_, err = index.Explain(&api.Lookup{Fields: []*api.LookupField{stringLookupField("region", "EU")}})
+	assert.ErrorIs(t, err, ErrFieldUnknown)
+}
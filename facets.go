@@ -0,0 +1,145 @@
+package db
+
+import (
+	"fmt"
+	api "github.com/segmentq/protos-api-go"
+	"github.com/tidwall/buntdb"
+	"sort"
+)
+
+// Facet is a value of a field with the number of matching segments which hold it
+type Facet struct {
+	Value *api.SegmentField
+	Count int64
+}
+
+// Facets counts the segments matching the lookup by each value of the fields, the values are read from the field
+// indexes rather than the segments. The facets of each field are ordered by count, the most common first.
+func (db *DB) Facets(indexName string, lookup *api.Lookup, fields ...string) (map[string][]*Facet, error) {
+	if _, ok := db.idx[indexName]; !ok {
+		return nil, ErrIndexUnknown
+	}
+
+	for _, field := range fields {
+		if _, ok := db.fields[indexName][field]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrFieldUnknown, field)
+		}
+		if !db.options[indexName][field].indexed() {
+			return nil, fmt.Errorf("%w: %s", ErrFieldNotIndexed, field)
+		}
+	}
+
+	t := &Iterator{idx: indexName, l: newLookup(db, nil, lookup, true)}
+	counts := make(map[string]map[string]int64, len(fields))
+	for _, field := range fields {
+		counts[field] = make(map[string]int64)
+	}
+
+	err := db.engine.View(func(tx *buntdb.Tx) error {
+		indexId, err := tx.Get(idxKey(idxById, indexName), true)
+		if err != nil {
+			return ErrInternalDBError
+		}
+
+		e := newEvaluator(t, tx, indexId)
+		query := t.l.tree()
+		if err = prepare(e, query); err != nil {
+			return err
+		}
+
+		var visitErr error
+		err = query.candidates(e, func(key string) bool {
+			ok, err := query.test(e, key)
+			if err != nil {
+				visitErr = err
+				return false
+			}
+			if !ok {
+				return true
+			}
+
+			for _, field := range fields {
+				values, err := readValues(tx, indexId, field, key)
+				if err != nil {
+					visitErr = err
+					return false
+				}
+
+				// A segment is counted once for each value it holds, however often it holds it
+				for n, value := range values {
+					if !containsValue(values[:n], value) {
+						counts[field][value]++
+					}
+				}
+			}
+			return true
+		})
+
+		if err != nil {
+			return err
+		}
+		return visitErr
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	facets := make(map[string][]*Facet, len(fields))
+	for _, field := range fields {
+		if facets[field], err = db.facetsOf(indexName, field, counts[field]); err != nil {
+			return nil, err
+		}
+	}
+
+	return facets, nil
+}
+
+// Facets counts the segments matching the lookup by each value of the fields, the values are read from the field
+// indexes rather than the segments. The facets of each field are ordered by count, the most common first.
+func (i *Index) Facets(lookup *api.Lookup, fields ...string) (map[string][]*Facet, error) {
+	return i.db.Facets(i.definition.Name, lookup, fields...)
+}
+
+// facetsOf decodes the values counted for a field, values with equal counts are ordered as the field index orders them
+func (db *DB) facetsOf(indexName string, field string, counts map[string]int64) ([]*Facet, error) {
+	definition, options := db.fields[indexName][field], db.options[indexName][field]
+
+	values := make([]string, 0, len(counts))
+	for value := range counts {
+		values = append(values, value)
+	}
+
+	less, ok := scalarLess(definition, options.fieldType())
+	if _, scalar := definition.GetDataType().(*api.FieldDefinition_Scalar); !ok || !scalar {
+		less = func(a, b string) bool { return a < b }
+	}
+
+	sort.Slice(values, func(a, b int) bool {
+		if counts[values[a]] != counts[values[b]] {
+			return counts[values[a]] > counts[values[b]]
+		}
+		return less(values[a], values[b])
+	})
+
+	facets := make([]*Facet, 0, len(values))
+	for _, value := range values {
+		decoded, err := NewFieldDefinitionStringer(definition).withType(options.fieldType()).UnmarshallText(value)
+		if err != nil {
+			return nil, err
+		}
+		facets = append(facets, &Facet{Value: decoded, Count: counts[value]})
+	}
+
+	return facets, nil
+}
+
+// containsValue reports whether the value is one of the values
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
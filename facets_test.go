@@ -0,0 +1,75 @@
+package db
+
+import (
+	api "github.com/segmentq/protos-api-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestIndex_Facets(t *testing.T) {
+	d := testNewDB(t)
+	index := testActiveIndex(t, d, 30)
+
+	facets, err := index.Facets(&api.Lookup{Fields: []*api.LookupField{stringLookupField("country", "GB")}},
+		"active", "country")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, []*Facet{
+		{Value: boolSegmentField("active", true), Count: 9},
+		{Value: boolSegmentField("active", false), Count: 1},
+	}, facets["active"])
+	assert.Equal(t, []*Facet{{Value: stringSegmentField("country", "GB"), Count: 10}}, facets["country"])
+
+	// Equal counts are ordered by value
+	facets, err = index.Facets(&api.Lookup{Fields: []*api.LookupField{boolLookupField("active", true)}}, "country")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []*Facet{
+		{Value: stringSegmentField("country", "DE"), Count: 9},
+		{Value: stringSegmentField("country", "FR"), Count: 9},
+		{Value: stringSegmentField("country", "GB"), Count: 9},
+	}, facets["country"])
+
+	facets, err = index.Facets(&api.Lookup{Fields: []*api.LookupField{stringLookupField("country", "US")}}, "active")
+	if assert.NoError(t, err) {
+		assert.Empty(t, facets["active"])
+	}
+
+	_, err = index.Facets(&api.Lookup{}, "region")
+	assert.ErrorIs(t, err, ErrFieldUnknown)
+
+	_, err = d.Facets("unknown", &api.Lookup{}, "active")
+	assert.ErrorIs(t, err, ErrIndexUnknown)
+}
+
+func TestIndex_Facets_Repeated(t *testing.T) {
+	d := testNewDB(t)
+	index := testCategoryIndex(t, d, nil)
+	testInsertCategories(t, index)
+
+	facets, err := index.Facets(testCategoryLookup("sports/football/championship"), "category")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Each value of a repeated field is counted
+	values := make(map[string]int64)
+	for _, facet := range facets["category"] {
+		values[facet.Value.GetStringValue().GetValue()] = facet.Count
+	}
+	assert.Equal(t, map[string]int64{
+		"sports":                       1,
+		"sports/football":              1,
+		"sports/football/championship": 1,
+	}, values)
+}
+
+func boolSegmentField(name string, value bool) *api.SegmentField {
+	return &api.SegmentField{
+		Name:  name,
+		Value: &api.SegmentField_BoolValue{BoolValue: &api.SegmentFieldBool{Value: value}},
+	}
+}
@@ -5,7 +5,10 @@ go 1.19
 require (
 	github.com/golang/protobuf v1.5.2
 	github.com/segmentq/protos-api-go v0.0.0-20221127133954-a44e5e92a6e9
+	github.com/stretchr/testify v1.8.1
 	github.com/tidwall/buntdb v1.2.10
+	github.com/tidwall/match v1.1.1
+	golang.org/x/text v0.4.0
 	google.golang.org/api v0.103.0
 )
 
@@ -13,17 +16,14 @@ require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/stretchr/objx v0.5.0 // indirect
-	github.com/stretchr/testify v1.8.1 // indirect
 	github.com/tidwall/btree v1.4.4 // indirect
 	github.com/tidwall/gjson v1.14.3 // indirect
 	github.com/tidwall/grect v0.1.4 // indirect
-	github.com/tidwall/match v1.1.1 // indirect
 	github.com/tidwall/pretty v1.2.1 // indirect
 	github.com/tidwall/rtred v0.1.2 // indirect
 	github.com/tidwall/tinyqueue v0.1.1 // indirect
 	golang.org/x/net v0.2.0 // indirect
 	golang.org/x/sys v0.2.0 // indirect
-	golang.org/x/text v0.4.0 // indirect
 	google.golang.org/genproto v0.0.0-20221118155620-16455021b5e6 // indirect
 	google.golang.org/grpc v1.51.0 // indirect
 	google.golang.org/protobuf v1.28.1 // indirect
@@ -30,6 +30,8 @@ var (
 		api.ScalarType_DATA_TYPE_FLOAT64: buntdb.IndexFloat,
 		// BOOL
 		api.ScalarType_DATA_TYPE_BOOL: buntdb.IndexBinary,
+		// BLOB, hex encoded so a binary comparison keeps the byte ordering
+		api.ScalarType_DATA_TYPE_BLOB: buntdb.IndexBinary,
 	}
 	fieldMapGeo = map[api.GeoType]func(a string) (min, max []float64){
 		// RANGEs
@@ -43,6 +45,39 @@ var (
 	}
 )
 
+// scalarLess returns the comparison the index of a scalar field orders its values by
+func scalarLess(definition *api.FieldDefinition, fieldType FieldType) (func(a, b string) bool, bool) {
+	switch fieldType {
+	case FieldTypeIP:
+		// IPs, hex encoded as IPv6 so a binary comparison keeps the address ordering
+		return buntdb.IndexBinary, true
+	case FieldTypePath:
+		// PATHs, compared byte by byte so a prefix scan finds every path below another
+		return buntdb.IndexBinary, true
+	}
+
+	less, ok := fieldMapScalar[definition.GetScalar()]
+	return less, ok
+}
+
+// foldsCase reports whether the index of a field compares its values without case, as buntdb.IndexString does
+func foldsCase(definition *api.FieldDefinition, fieldType FieldType) bool {
+	if _, ok := definition.GetDataType().(*api.FieldDefinition_Scalar); !ok {
+		return false
+	}
+
+	switch fieldType {
+	case FieldTypeIP, FieldTypePath:
+		return false
+	}
+
+	switch definition.GetScalar() {
+	case api.ScalarType_DATA_TYPE_UNDEFINED, api.ScalarType_DATA_TYPE_STRING:
+		return true
+	}
+	return false
+}
+
 type Index struct {
 	db         *DB
 	definition *api.IndexDefinition
@@ -94,7 +129,7 @@ func (db *DB) GetIndexByName(name string) (*Index, error) {
 	}, nil
 }
 
-// ListIndexes returns an unbuffered list of all indexes TODO maybe some limit to this?
+// ListIndexes returns an unbuffered list of all indexes, ListIndexesPage limits the list
 func (db *DB) ListIndexes() []*api.IndexDefinition {
 	list := make([]*api.IndexDefinition, 0, len(db.idx))
 
@@ -123,6 +158,10 @@ func (i *Index) Exists() (bool, error) {
 
 // Create is used when the Index is instantiated directly
 func (i *Index) Create() error {
+	return i.create(nil)
+}
+
+func (i *Index) create(options map[string]*FieldOptions) error {
 	exists, err := i.Exists()
 	if err != nil {
 		return err
@@ -131,6 +170,11 @@ func (i *Index) Create() error {
 		return ErrIndexExists
 	}
 
+	options, err = prepareOptions(i.definition, options)
+	if err != nil {
+		return err
+	}
+
 	var idStr string
 	err = i.db.engine.Update(func(tx *buntdb.Tx) error {
 		// Determine the last insert id
@@ -158,7 +202,11 @@ func (i *Index) Create() error {
 			return err2
 		}
 
-		return i.storeIndexes(tx, idStr)
+		if err2 = i.storeIndexes(tx, idStr); err2 != nil {
+			return err2
+		}
+
+		return i.storeOptions(tx, options)
 	})
 
 	if err != nil {
@@ -167,9 +215,10 @@ func (i *Index) Create() error {
 
 	// Store in memory
 	i.db.loadIndexFields(i.definition)
+	i.db.loadIndexOptions(i.definition.Name, options)
 
 	// Configure the field indexes
-	return i.db.createIndexFields(idStr, i.definition.Fields)
+	return i.db.createIndexFields(idStr, i.indexedFields(), options)
 }
 
 func (i *Index) Definition() *api.IndexDefinition {
@@ -220,16 +269,17 @@ func (i *Index) deleteKeys(idx string, tx *buntdb.Tx) error {
 		}
 	}
 
-	return nil
+	return i.deleteOptions(tx)
 }
 
 func (i *Index) dropIndexes(idx string, tx *buntdb.Tx) error {
 	indexes := []string{
 		idx,
 		idxKey(segmentByPrimaryKey, idx),
+		idxKey(idx, unconstrainedFields),
 	}
 
-	for _, field := range i.definition.Fields {
+	for _, field := range i.indexedFields() {
 		indexes = append(indexes, idxKey(idx, field.Name))
 	}
 
@@ -299,6 +349,13 @@ func (i *Index) createIndexes(tx *buntdb.Tx, idStr string) error {
 	if err != nil {
 		return ErrInternalDBError
 	}
+	// Segments which omit a field that matches any value when missing are marked by field name, which is compared
+	// with case as field names are
+	err = tx.CreateIndex(idxKey(idStr, unconstrainedFields), idxKey(idStr, unconstrainedFields, wildcard),
+		buntdb.IndexBinary)
+	if err != nil {
+		return ErrInternalDBError
+	}
 
 	return nil
 }
@@ -333,14 +390,21 @@ func (i *Index) storeIndexes(tx *buntdb.Tx, idStr string) error {
 // loadIndexes is used to load all known indexes into memory, usually when starting the engine
 func (db *DB) loadIndexes() error {
 	err := db.engine.View(func(tx *buntdb.Tx) error {
-		return tx.Ascend(fieldDefByIdx, func(name, index string) bool {
+		// Definitions have no engine index of their own, they are found by the pattern of their keys
+		return tx.AscendKeys(idxKey(fieldDefByIdx, wildcard), func(name, index string) bool {
 			indexProto := &api.IndexDefinition{}
 			err := proto.UnmarshalText(index, indexProto)
 			if err != nil {
 				return false
 			}
 
+			options, err := db.readOptions(tx, indexProto.Name)
+			if err != nil {
+				return false
+			}
+
 			db.loadIndexFields(indexProto)
+			db.loadIndexOptions(indexProto.Name, options)
 			return true
 		})
 	})
@@ -350,6 +414,35 @@ func (db *DB) loadIndexes() error {
 	return nil
 }
 
+// restoreIndexes loads the indexes stored in a database opened from a file and creates their engine indexes
+func (db *DB) restoreIndexes() error {
+	if err := db.loadIndexes(); err != nil {
+		return err
+	}
+
+	for name, definition := range db.idx {
+		i := newIndex(db, definition)
+
+		var idStr string
+		err := db.engine.Update(func(tx *buntdb.Tx) error {
+			var err error
+			if idStr, err = tx.Get(idxKey(idxById, name), true); err != nil {
+				return ErrInternalDBError
+			}
+			return i.createIndexes(tx, idStr)
+		})
+		if err != nil {
+			return err
+		}
+
+		if err = db.createIndexFields(idStr, i.indexedFields(), db.options[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // loadIndexFields is used to load all known fields into memory, usually when starting the engine
 func (db *DB) loadIndexFields(index *api.IndexDefinition) {
 	db.idx[index.Name] = index
@@ -363,9 +456,9 @@ func (db *DB) loadIndexFields(index *api.IndexDefinition) {
 }
 
 // createIndexFields registers all field indexes in the engine
-func (db *DB) createIndexFields(path string, fields []*api.FieldDefinition) error {
+func (db *DB) createIndexFields(path string, fields []*api.FieldDefinition, options map[string]*FieldOptions) error {
 	for _, field := range fields {
-		err := db.createIndexField(path, field)
+		err := db.createIndexField(path, field, options[field.Name])
 		if err != nil {
 			return err
 		}
@@ -374,7 +467,7 @@ func (db *DB) createIndexFields(path string, fields []*api.FieldDefinition) erro
 }
 
 // createIndexField prepares the correct indexes for a given field and key path (index)
-func (db *DB) createIndexField(path string, field *api.FieldDefinition) (err error) {
+func (db *DB) createIndexField(path string, field *api.FieldDefinition, options *FieldOptions) (err error) {
 	if field == nil {
 		return ErrFieldUnknown
 	}
@@ -384,7 +477,7 @@ func (db *DB) createIndexField(path string, field *api.FieldDefinition) (err err
 
 	switch field.DataType.(type) {
 	case *api.FieldDefinition_Scalar:
-		index, ok := fieldMapScalar[field.GetScalar()]
+		index, ok := scalarLess(field, options.fieldType())
 		if !ok {
 			return ErrUnknownDataType
 		}
@@ -403,7 +496,7 @@ func (db *DB) createIndexField(path string, field *api.FieldDefinition) (err err
 	}
 
 	for _, nestedField := range field.Fields {
-		err = db.createIndexField(name, nestedField)
+		err = db.createIndexField(name, nestedField, nil)
 		if err != nil {
 			return err
 		}
@@ -424,6 +517,7 @@ func (i *Index) UnmarshallPrimaryValue(value string) (*api.SegmentField, error)
 		return nil, ErrPrimaryKeyMissing
 	}
 
-	s := NewFieldDefinitionStringer(primaryDefinition)
+	options := i.db.options[i.definition.Name][primaryDefinition.Name]
+	s := NewFieldDefinitionStringer(primaryDefinition).withType(options.fieldType())
 	return s.UnmarshallText(value)
 }
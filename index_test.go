@@ -370,7 +370,7 @@ func TestDB_createIndexField(t *testing.T) {
 				idx:    tt.fields.idx,
 				fields: tt.fields.fields,
 			}
-			tt.wantErr(t, db.createIndexField(tt.args.path, tt.args.field), fmt.Sprintf("createIndexField(%v, %v)", tt.args.path, tt.args.field))
+			tt.wantErr(t, db.createIndexField(tt.args.path, tt.args.field, nil), fmt.Sprintf("createIndexField(%v, %v)", tt.args.path, tt.args.field))
 		})
 	}
 }
@@ -455,7 +455,7 @@ func TestDB_createIndexFields(t *testing.T) {
 				idx:    tt.fields.idx,
 				fields: tt.fields.fields,
 			}
-			tt.wantErr(t, db.createIndexFields(tt.args.path, tt.args.fields), fmt.Sprintf("createIndexFields(%v, %v)", tt.args.path, tt.args.fields))
+			tt.wantErr(t, db.createIndexFields(tt.args.path, tt.args.fields, nil), fmt.Sprintf("createIndexFields(%v, %v)", tt.args.path, tt.args.fields))
 		})
 	}
 }
@@ -575,6 +575,16 @@ func TestIndex_UnmarshallPrimaryValue(t *testing.T) {
 			},
 		},
 	}
+	rangeDef := &api.IndexDefinition{
+		Name: "fruits",
+		Fields: []*api.FieldDefinition{
+			{
+				Name:      "season",
+				DataType:  &api.FieldDefinition_Geo{Geo: api.GeoType_DATA_TYPE_RANGE_INT},
+				IsPrimary: true,
+			},
+		},
+	}
 
 	type fields struct {
 		db         *DB
@@ -646,6 +656,27 @@ func TestIndex_UnmarshallPrimaryValue(t *testing.T) {
 			},
 			wantErr: assert.NoError,
 		},
+		{
+			name:   "golden path range int",
+			fields: fields{db: d, definition: rangeDef},
+			args:   args{value: "[-inf 3], [+inf 9]"},
+			want: &api.SegmentField{
+				Name: "season",
+				Value: &api.SegmentField_RangeIntValue{
+					RangeIntValue: &api.SegmentFieldRangeInt{
+						Min: 3,
+						Max: 9,
+					},
+				},
+			},
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "invalid range",
+			fields:  fields{db: d, definition: rangeDef},
+			args:    args{value: "[3 9]"},
+			wantErr: assert.Error,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -1,50 +1,108 @@
 package db
 
 import (
+	"fmt"
 	"github.com/golang/protobuf/proto"
 	api "github.com/segmentq/protos-api-go"
 	"github.com/tidwall/buntdb"
 	"google.golang.org/api/iterator"
+	"strconv"
 )
 
 type Lookup struct {
-	db       *DB
-	index    *Index
-	lookup   *api.Lookup
-	keysOnly bool
+	db        *DB
+	index     *Index
+	lookup    *api.Lookup
+	keysOnly  bool
+	operators map[string]Operator
+	query     Query
+	paged     bool
+	limit     int
+	offset    int
+	cursor    string
+
+	sorted     bool
+	sortField  string
+	descending bool
+
+	scoring *scoring
 }
 
-func newLookup(db *DB, index *Index, lookup *api.Lookup, keysOnly bool) *Lookup {
-	return &Lookup{
+// LookupOption changes how a lookup matches segments
+type LookupOption func(l *Lookup)
+
+// WithOperator compares the values of every lookup field with the given name using the operator instead of equality
+func WithOperator(field string, operator Operator) LookupOption {
+	return func(l *Lookup) {
+		if l.operators == nil {
+			l.operators = make(map[string]Operator)
+		}
+		l.operators[field] = operator
+	}
+}
+
+// WithQuery matches segments with a query tree as well as the fields of the lookup, the lookup may then be empty
+func WithQuery(query Query) LookupOption {
+	return func(l *Lookup) {
+		l.query = query
+	}
+}
+
+// WithPage returns no more than limit results in the order of their keys, starting after the cursor returned by
+// Iterator.Cursor for the previous page. A limit of 0 or less returns every result after the cursor.
+func WithPage(limit int, cursor string) LookupOption {
+	return func(l *Lookup) {
+		l.paged = true
+		l.limit = limit
+		l.cursor = cursor
+	}
+}
+
+// WithOffset skips the given number of results, those of a lookup run WithPage are skipped from its cursor so the
+// page holds the results which follow them
+func WithOffset(offset int) LookupOption {
+	return func(l *Lookup) {
+		l.offset = offset
+	}
+}
+
+func newLookup(db *DB, index *Index, lookup *api.Lookup, keysOnly bool, opts ...LookupOption) *Lookup {
+	l := &Lookup{
 		db:       db,
 		index:    index,
 		lookup:   lookup,
 		keysOnly: keysOnly,
 	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
 }
 
 // Lookup is a convenience method on the db object which only returns segment keys
-func (db *DB) Lookup(indexName string, lookup *api.Lookup) (*Iterator, error) {
-	return db.lookup(indexName, lookup, true)
+func (db *DB) Lookup(indexName string, lookup *api.Lookup, opts ...LookupOption) (*Iterator, error) {
+	return db.lookup(indexName, lookup, true, opts...)
 }
 
 // LookupSegments returns full segment objects and is slower than Lookup
-func (db *DB) LookupSegments(indexName string, lookup *api.Lookup) (*Iterator, error) {
-	return db.lookup(indexName, lookup, false)
+func (db *DB) LookupSegments(indexName string, lookup *api.Lookup, opts ...LookupOption) (*Iterator, error) {
+	return db.lookup(indexName, lookup, false, opts...)
 }
 
 // Lookup is a convenience method on the index object which only returns segment keys
-func (i *Index) Lookup(lookup *api.Lookup) (*Iterator, error) {
-	return i.db.lookup(i.definition.Name, lookup, true)
+func (i *Index) Lookup(lookup *api.Lookup, opts ...LookupOption) (*Iterator, error) {
+	return i.db.lookup(i.definition.Name, lookup, true, opts...)
 }
 
 // LookupSegments returns full segment objects and is slower than Lookup
-func (i *Index) LookupSegments(lookup *api.Lookup) (*Iterator, error) {
-	return i.db.lookup(i.definition.Name, lookup, false)
+func (i *Index) LookupSegments(lookup *api.Lookup, opts ...LookupOption) (*Iterator, error) {
+	return i.db.lookup(i.definition.Name, lookup, false, opts...)
 }
 
-func (db *DB) lookup(indexName string, lookup *api.Lookup, keysOnly bool) (*Iterator, error) {
-	l := newLookup(db, nil, lookup, keysOnly)
+func (db *DB) lookup(indexName string, lookup *api.Lookup, keysOnly bool, opts ...LookupOption) (*Iterator, error) {
+	l := newLookup(db, nil, lookup, keysOnly, opts...)
 	it := l.RunOnIndex(indexName)
 
 	if it.err != nil {
@@ -63,15 +121,68 @@ func (l *Lookup) Run() *Iterator {
 }
 
 func (l *Lookup) RunOnIndex(indexName string) *Iterator {
-	// TODO limit?
-	return &Iterator{idx: indexName, l: l}
+	it := &Iterator{idx: indexName, l: l, query: l.tree()}
+
+	if it.order, it.err = l.newOrder(indexName); it.err != nil {
+		return it
+	}
+	if score, ok := it.query.(*scoreQuery); ok {
+		if l.sorted {
+			it.err = fmt.Errorf("%w: scored lookups are ordered by score", ErrInvalidSort)
+			return it
+		}
+		it.order = scoreOrder(score)
+	}
+
+	if l.paged {
+		if it.page, it.err = newPage(l.limit, l.cursor, l.fingerprint(indexName), it.order); it.err == nil {
+			it.page.offset = l.offset
+		}
+		return it
+	}
+
+	// Unordered lookups are found in the order of the primary field index, so each batch resumes its scan from the
+	// last result of the batch before
+	if !l.sorted && l.scoring == nil {
+		if primary, err := l.fieldOrder(indexName, "", false); err == nil {
+			it.order = primary
+		}
+	}
+
+	return it
 }
 
+// segmentBatch is the number of results a lookup finds in each read transaction
+const segmentBatch = 64
+
+// Iterator streams the results of a lookup in batches. Each batch is found in its own read transaction by scanning
+// the most selective field, or the index the results are ordered by, and checking the rest of the lookup against each
+// candidate, resuming after the last result of the batch before. No transaction is held between calls to Next, so
+// writes made while iterating do not wait for the iterator and are seen by the batches which follow them.
 type Iterator struct {
-	idx  string
-	l    *Lookup
-	err  error
-	keys []string
+	idx    string
+	l      *Lookup
+	query  Query
+	err    error
+	found  bool
+	page   *page
+	order  *order
+	cursor string
+	score  float64
+
+	results   []result
+	after     *entry
+	returned  int
+	exhausted bool
+}
+
+// result is a match of a lookup, with its position in the order of the lookup
+type result struct {
+	key      string
+	segment  *api.Segment
+	cursor   string
+	score    float64
+	position entry
 }
 
 func (t *Iterator) Next(dst *api.Segment) (key string, err error) {
@@ -85,143 +196,404 @@ func (t *Iterator) Next(dst *api.Segment) (key string, err error) {
 	return key, err
 }
 
-func (t *Iterator) next() (key string, segment *api.Segment, err error) {
-	// Lookup keys while there are no results
-	for t.err == nil && len(t.keys) == 0 {
-		t.err = t.lookup()
+// Cursor returns the cursor of the next page of a lookup run WithPage once the last result of the page has been
+// returned, it is empty on the last page
+func (t *Iterator) Cursor() string {
+	return t.cursor
+}
+
+// Score returns the score of the last result of a lookup run WithScoring
+func (t *Iterator) Score() float64 {
+	return t.score
+}
+
+// Close stops the lookup, no more batches are found and Next returns iterator.Done
+func (t *Iterator) Close() {
+	t.results, t.exhausted = nil, true
+	if t.err == nil {
+		t.err = iterator.Done
 	}
+}
 
+func (t *Iterator) next() (key string, segment *api.Segment, err error) {
 	if t.err != nil {
 		return "", nil, t.err
 	}
 
-	key = t.keys[0]
-	t.keys = t.keys[1:]
+	if len(t.results) == 0 && !t.exhausted {
+		if t.err = t.fetch(); t.err != nil {
+			return "", nil, t.err
+		}
+	}
 
-	if len(t.keys) == 0 {
-		t.err = iterator.Done // At the end of the batch.
+	if len(t.results) == 0 {
+		// At the end of the results
+		t.err = ErrLookupEmpty
+		if t.found {
+			t.err = iterator.Done
+		}
+		return "", nil, t.err
 	}
 
-	if t.l.keysOnly {
-		return key, nil, nil
+	r := t.results[0]
+	t.results = t.results[1:]
+
+	t.found = true
+	t.cursor = r.cursor
+	t.score = r.score
+	return r.key, r.segment, nil
+}
+
+// fetch finds the next batch of results in a read transaction. A lookup run WithPage is found in batches of its page,
+// the last of which returns the cursor of the next page.
+func (t *Iterator) fetch() error {
+	p := &page{limit: segmentBatch, after: t.after, order: t.order}
+	if t.after == nil {
+		p.offset = t.l.offset
+	}
+	last := false
+	if t.page != nil {
+		p.scope = t.page.scope
+		if t.after == nil {
+			p.after = t.page.after
+		}
+		if remaining := t.page.limit - t.returned; t.page.limit > 0 && remaining <= segmentBatch {
+			p.limit, last = remaining, true
+		}
 	}
 
-	err = t.l.db.engine.View(func(tx *buntdb.Tx) error {
-		segmentText, err := tx.Get(idxKey(segmentByPrimaryKey, t.idx, key))
+	batch := make([]result, 0, p.limit)
+	err := t.l.db.engine.View(func(tx *buntdb.Tx) error {
+		// Find the integer index of the index
+		// TODO can we store this in DB struct?
+		indexId, err := tx.Get(idxKey(idxById, t.idx), true)
 		if err != nil {
-			return ErrSegmentMissing
+			return ErrInternalDBError
 		}
-		err = proto.UnmarshalText(segmentText, segment)
+
+		var readErr error
+		err = t.runPage(tx, indexId, p, func(r result) bool {
+			if !t.l.keysOnly {
+				if r.segment, readErr = readSegment(tx, indexId, r.key); readErr != nil {
+					return false
+				}
+			}
+			batch = append(batch, r)
+			return true
+		})
 		if err != nil {
-			return ErrSegmentMissing
+			return err
 		}
-		return nil
+		return readErr
 	})
-
 	if err != nil {
-		return "", nil, err
+		return err
 	}
 
-	return key, segment, nil
-}
+	// The cursor of a full batch tells another follows, only the last batch of a page returns it
+	if last || len(batch) < p.limit || batch[len(batch)-1].cursor == "" {
+		t.exhausted = true
+	} else {
+		t.after = &batch[len(batch)-1].position
+		batch[len(batch)-1].cursor = ""
+	}
 
-type matcher struct {
-	field     *api.LookupField
-	refKeyMap map[string]string // The reference key map
-	refKeySet []string          // The reference key set
-	keyMap    map[string]string
-	keySet    []string
+	t.returned += len(batch)
+	t.results = batch
+	return nil
 }
 
-func newMatcher() *matcher {
-	return &matcher{}
-}
+// readSegment reads a segment found by a lookup
+func readSegment(tx *buntdb.Tx, indexId string, key string) (*api.Segment, error) {
+	segmentText, err := tx.Get(idxKey(segmentByPrimaryKey, indexId, key))
+	if err != nil {
+		return nil, ErrSegmentMissing
+	}
 
-func (m *matcher) setField(field *api.LookupField) {
-	// Any existing key maps become reference
-	m.refKeyMap = m.keyMap
-	m.refKeySet = m.keySet
-	m.field = field
-	m.keyMap = make(map[string]string)
-	m.keySet = make([]string, 0)
+	segment := &api.Segment{}
+	if err = proto.UnmarshalText(segmentText, segment); err != nil {
+		return nil, ErrSegmentMissing
+	}
+	return segment, nil
 }
 
-func (m *matcher) match(key, _ string) bool {
-	keyObject := keyFromString(key)
-	k, exists := keyObject.SegmentKey()
-	if !exists {
-		return false
+// run finds every match of the lookup in the index and passes them to deliver, until it reports false
+func (t *Iterator) run(tx *buntdb.Tx, indexId string, deliver func(r result) bool) error {
+	// Sorted, scored, paged and offset results are found in order, unordered results as soon as they are found
+	if t.page != nil || t.l.sorted || t.l.scoring != nil || t.l.offset > 0 {
+		p := t.page
+		if p == nil {
+			p = &page{order: t.order, offset: t.l.offset}
+		}
+		return t.runPage(tx, indexId, p, deliver)
 	}
 
-	// Check if the key was matched on the previous field, if so add to the new map
-	// OR refKeySet length is 0 which means we are on the first field
-	if _, ok := m.refKeyMap[k]; ok || len(m.refKeySet) == 0 {
-		m.keyMap[k] = m.field.Name
-		m.keySet = append(m.keySet, k)
+	e := newEvaluator(t, tx, indexId)
+	query := t.query
+	if err := prepare(e, query); err != nil {
+		return err
 	}
 
-	return true
-}
+	var streamErr error
+	err := query.candidates(e, func(key string) bool {
+		ok, err := query.test(e, key)
+		if err != nil {
+			streamErr = err
+			return false
+		}
+		if !ok {
+			return true
+		}
+		return deliver(result{key: key, position: entry{key: key}})
+	})
 
-func (m *matcher) getMatchCount() int {
-	return len(m.keySet)
+	if err != nil {
+		return err
+	}
+	return streamErr
 }
 
-func (m *matcher) getMatches() []string {
-	return m.keySet
+// runPage finds the matches of the lookup on the page in order and passes them to deliver, until it reports false
+func (t *Iterator) runPage(tx *buntdb.Tx, indexId string, p *page, deliver func(r result) bool) error {
+	e := newEvaluator(t, tx, indexId)
+	query := t.query
+	if err := prepare(e, query); err != nil {
+		return err
+	}
+
+	return t.streamOrdered(e, query, p, func(match entry, cursor string) bool {
+		r := result{key: match.key, cursor: cursor, position: match}
+		if t.l.scoring != nil {
+			r.score, _ = strconv.ParseFloat(match.value, 64)
+		}
+		return deliver(r)
+	})
 }
 
-func (t *Iterator) lookup() error {
-	if t.err != nil {
-		return t.err
+// prepareField checks a lookup field against the definition and options of the field it is looked up in
+func (t *Iterator) prepareField(field *api.LookupField, operator Operator) (*api.FieldDefinition, *api.LookupField,
+	*FieldOptions, error) {
+	definition, ok := t.l.db.fields[t.idx][field.Name]
+	if !ok {
+		return nil, nil, nil, ErrFieldUnknown
 	}
 
-	// Start a matcher to hold the results of the index matches
-	m := newMatcher()
+	options := t.l.db.options[t.idx][field.Name]
+	if !options.indexed() {
+		return nil, nil, nil, fmt.Errorf("%w: %s", ErrFieldNotIndexed, field.Name)
+	}
 
-	err := t.l.db.engine.View(func(tx *buntdb.Tx) error {
-		// Find the integer index of the index
-		// TODO can we store this in DB struct?
-		indexId, err := tx.Get(idxKey(idxById, t.idx), true)
-		if err != nil {
-			return ErrInternalDBError
-		}
+	if err := checkOperator(definition, options, operator); err != nil {
+		return nil, nil, nil, err
+	}
+	if operator == OperatorBetween {
+		field = betweenField(field)
+	}
 
-		return t.scanAllFields(indexId, m, tx)
-	})
+	field, err := checkLookupField(definition, field, options)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return definition, field, options, nil
+}
 
+// scanField visits the keys in the field index which match the lookup field with the operator
+func (t *Iterator) scanField(tx *buntdb.Tx, indexId string, field *api.LookupField, operator Operator,
+	iter func(key, value string) bool) error {
+	definition, field, options, err := t.prepareField(field, operator)
 	if err != nil {
 		return err
 	}
 
-	// Work out our matches across all keys
-	t.keys = m.getMatches()
+	// Operators other than equality scan the part of the ordered index which could hold matching values
+	if operator != OperatorEqual {
+		return scanOperator(tx, idxKey(indexId, field.Name), definition, field, operator, options, iter)
+	}
+
+	// Timestamps between two times, addresses within a block and paths are found with range scans of the ordered index
+	ranges, isRange, err := scanRanges(definition, field, options)
+	if err != nil {
+		return err
+	}
+	if isRange {
+		for _, r := range ranges {
+			if err = tx.AscendRange(idxKey(indexId, field.Name), r.greaterOrEqual, r.lessThan, iter); err != nil {
+				return ErrLookupFailure
+			}
+		}
+		return nil
+	}
+
+	s := NewLookupStringer(field, func(_, value string) bool {
+		if isGeoLookupField(field) || isSpatialField(definition, options.fieldType()) {
+			return tx.Intersects(idxKey(indexId, field.Name), value, iter) == nil
+		}
+		return tx.AscendEqual(idxKey(indexId, field.Name), value, iter) == nil
+	}).withDefinition(definition).withType(options.fieldType()).withCollation(options.collation())
+
+	if err := s.MarshallText(); err != nil {
+		return ErrLookupFailure
+	}
+
 	return nil
 }
 
-// scanAllFields iterates through each lookup field to hydrate the matcher
-func (t *Iterator) scanAllFields(indexId string, m *matcher, tx *buntdb.Tx) error {
-	// For each of the lookup fields, scan the indexes
-	for _, field := range t.l.lookup.Fields {
-		m.setField(field)
+// fieldTest reports which values of a field index the scan of a lookup field visits, so a candidate found by
+// another field can be checked by reading its own values instead of scanning
+type fieldTest struct {
+	visits func(value string) bool
+
+	// every is set for operators which match the segments with no unvisited values, rather than any visited value
+	every bool
+}
 
-		s := NewLookupStringer(field, func(_, value string) bool {
-			if isGeoLookupField(field) {
-				return tx.Intersects(idxKey(indexId, field.Name), value, m.match) == nil
+// accepts reports whether a segment holding the values matches the lookup field
+func (f *fieldTest) accepts(values []string) bool {
+	if f.every {
+		for _, value := range values {
+			if !f.visits(value) {
+				return false
 			}
-			return tx.AscendEqual(idxKey(indexId, field.Name), value, m.match) == nil
-		})
+		}
+		return len(values) > 0
+	}
+
+	for _, value := range values {
+		if f.visits(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// newFieldTest returns the test of the values scanField visits for the lookup field with the operator
+func (t *Iterator) newFieldTest(field *api.LookupField, operator Operator) (*fieldTest, error) {
+	definition, field, options, err := t.prepareField(field, operator)
+	if err != nil {
+		return nil, err
+	}
 
-		if err := s.MarshallText(); err != nil {
-			return ErrLookupFailure
+	switch operator {
+	case OperatorEqual:
+	case OperatorPrefix, OperatorWildcard, OperatorRegex:
+		patterns, err := lookupPatterns(definition, field, operator, options.collation())
+		if err != nil {
+			return nil, err
+		}
+		return &fieldTest{visits: func(value string) bool {
+			for _, p := range patterns {
+				if p.visits(value) {
+					return true
+				}
+			}
+			return false
+		}}, nil
+	default:
+		pivots, err := lookupPivots(definition, field, options)
+		if err != nil {
+			return nil, err
 		}
+		less, _ := scalarLess(definition, options.fieldType())
+		visits, err := compareValue(less, operator, pivots)
+		if err != nil {
+			return nil, err
+		}
+		return &fieldTest{visits: visits, every: operator == OperatorNotEqual}, nil
+	}
 
-		if m.getMatchCount() == 0 {
-			return ErrLookupEmpty
+	ranges, isRange, err := scanRanges(definition, field, options)
+	if err != nil {
+		return nil, err
+	}
+	if isRange {
+		less, _ := scalarLess(definition, options.fieldType())
+		return &fieldTest{visits: func(value string) bool {
+			for _, r := range ranges {
+				if !less(value, r.greaterOrEqual) && less(value, r.lessThan) {
+					return true
+				}
+			}
+			return false
+		}}, nil
+	}
+
+	pivots, err := lookupPivots(definition, field, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if isGeoLookupField(field) || isSpatialField(definition, options.fieldType()) {
+		return &fieldTest{visits: func(value string) bool {
+			for _, pivot := range pivots {
+				if intersects(value, pivot) {
+					return true
+				}
+			}
+			return false
+		}}, nil
+	}
+
+	less, _ := scalarLess(definition, options.fieldType())
+	return &fieldTest{visits: func(value string) bool { return equalsAny(less, value, pivots) }}, nil
+}
+
+// intersects reports whether two rects of a spatial index intersect, as tx.Intersects finds them
+func intersects(a, b string) bool {
+	aMin, aMax := buntdb.IndexRect(a)
+	bMin, bMax := buntdb.IndexRect(b)
+	for n := 0; n < len(aMin) && n < len(bMin); n++ {
+		if aMin[n] > bMax[n] || bMin[n] > aMax[n] {
+			return false
 		}
 	}
+	return true
+}
 
-	return nil
+// readValues returns the values a segment holds in a field index, in the order they were written
+func readValues(tx *buntdb.Tx, indexId string, field string, key string) ([]string, error) {
+	values := make([]string, 0, 1)
+	for n := 0; ; n++ {
+		value, err := tx.Get(idxKey(indexId, field, key, strconv.Itoa(n)), true)
+		if err == buntdb.ErrNotFound {
+			return values, nil
+		}
+		if err != nil {
+			return nil, ErrLookupFailure
+		}
+		values = append(values, value)
+	}
+}
+
+// keyRange holds the inclusive greater or equal and exclusive less than pivots of a range scan
+type keyRange struct {
+	greaterOrEqual string
+	lessThan       string
+}
+
+// scanRanges returns the pivots for lookups which are answered by range scans of an ordered index
+func scanRanges(definition *api.FieldDefinition, field *api.LookupField, options *FieldOptions) ([]keyRange, bool, error) {
+	if isTemporalBetween(definition, options.fieldType(), field) {
+		r, err := temporalBetween(definition, options.fieldType(), field)
+		return []keyRange{r}, true, err
+	}
+
+	if isIPBetween(definition, options.fieldType(), field) {
+		greaterOrEqual, lessThan, err := ipBetween(field)
+		return []keyRange{{greaterOrEqual: greaterOrEqual, lessThan: lessThan}}, true, err
+	}
+
+	if isPathScalar(definition, options.fieldType()) {
+		ranges, err := pathRanges(definition, field, options.matchDescendants())
+		return ranges, true, err
+	}
+
+	return nil, false, nil
+}
+
+// isSpatialField reports whether scalar lookup values are matched against a spatial index
+func isSpatialField(definition *api.FieldDefinition, fieldType FieldType) bool {
+	return isTimestampRange(definition, fieldType) || isCIDRRange(definition, fieldType)
 }
 
 func isGeoLookupField(field *api.LookupField) bool {
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"errors"
+	api "github.com/segmentq/protos-api-go"
+	"sort"
+)
+
+// LookupAll runs the lookup on each of the indexes, or on every index when none are named, and returns the keys
+// matched in each index by its name. Lookup fields an index does not define, does not index or holds values of
+// another type in are ignored rather than failing, and an index which can look up none of the fields of a lookup is
+// skipped. Indexes without matches are omitted.
+func (db *DB) LookupAll(lookup *api.Lookup, indexNames ...string) (map[string][]string, error) {
+	if len(indexNames) == 0 {
+		for name := range db.idx {
+			indexNames = append(indexNames, name)
+		}
+		sort.Strings(indexNames)
+	}
+
+	batch := make([]*BatchLookup, 0, len(indexNames))
+	for _, name := range indexNames {
+		if _, ok := db.idx[name]; !ok {
+			return nil, ErrIndexUnknown
+		}
+
+		fields := make([]*api.LookupField, 0, len(lookup.GetFields()))
+		for _, field := range lookup.GetFields() {
+			if db.fitsLookupField(name, field) {
+				fields = append(fields, field)
+			}
+		}
+		if len(fields) == 0 && len(lookup.GetFields()) > 0 {
+			continue
+		}
+
+		batch = append(batch, &BatchLookup{IndexName: name, Lookup: &api.Lookup{Fields: fields}})
+	}
+
+	results, err := db.LookupBatch(batch)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make(map[string][]string)
+	for n, result := range results {
+		if errors.Is(result.Err, ErrLookupEmpty) {
+			continue
+		}
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		matches[batch[n].IndexName] = result.Keys
+	}
+
+	return matches, nil
+}
+
+// fitsLookupField reports whether the index can look up the field, it must define and index the field with a type
+// the lookup value matches
+func (db *DB) fitsLookupField(indexName string, field *api.LookupField) bool {
+	definition, ok := db.fields[indexName][field.Name]
+	if !ok {
+		return false
+	}
+
+	options := db.options[indexName][field.Name]
+	if !options.indexed() {
+		return false
+	}
+
+	_, err := checkLookupField(definition, field, options)
+	return err == nil
+}
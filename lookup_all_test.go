@@ -0,0 +1,92 @@
+package db
+
+import (
+	api "github.com/segmentq/protos-api-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDB_LookupAll(t *testing.T) {
+	d := testNewDB(t)
+	testActiveIndex(t, d, 30)
+	testPriorityIndex(t, d, 10)
+
+	// An index which does not index country and holds active as an int fits none of the lookup fields
+	misfit, err := d.CreateIndexWithOptions(&api.IndexDefinition{
+		Name: "misfit",
+		Fields: []*api.FieldDefinition{
+			{
+				Name:      "name",
+				DataType:  &api.FieldDefinition_Scalar{Scalar: api.ScalarType_DATA_TYPE_STRING},
+				IsPrimary: true,
+			},
+			scalarField("active", api.ScalarType_DATA_TYPE_INT),
+			scalarField("country", api.ScalarType_DATA_TYPE_STRING),
+		},
+	}, map[string]*FieldOptions{"country": {NotIndexed: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	segment := getSingleFieldSegment("misfit-0")
+	segment.Fields = append(segment.Fields, intSegmentField("active", 0), stringSegmentField("country", "GB"))
+	if _, err = misfit.InsertSegment(segment); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		lookup     *api.Lookup
+		indexNames []string
+		want       map[string][]string
+		wantErr    error
+	}{
+		{
+			name: "every index",
+			lookup: &api.Lookup{Fields: []*api.LookupField{
+				boolLookupField("active", false),
+				stringLookupField("country", "GB"),
+			}},
+			want: map[string][]string{"active": {"segment-0"}, "priorities": {"segment-03"}},
+		},
+		{
+			name: "named index",
+			lookup: &api.Lookup{Fields: []*api.LookupField{
+				boolLookupField("active", false),
+				stringLookupField("country", "GB"),
+			}},
+			indexNames: []string{"priorities"},
+			want:       map[string][]string{"priorities": {"segment-03"}},
+		},
+		{
+			name:   "index defining none of the fields",
+			lookup: &api.Lookup{Fields: []*api.LookupField{intLookupField("priority", 4)}},
+			want:   map[string][]string{"priorities": {"segment-04", "segment-09"}},
+		},
+		{
+			name:   "no match",
+			lookup: &api.Lookup{Fields: []*api.LookupField{stringLookupField("country", "US")}},
+			want:   map[string][]string{},
+		},
+		{
+			name:       "unknown index",
+			lookup:     &api.Lookup{},
+			indexNames: []string{"active", "unknown"},
+			wantErr:    ErrIndexUnknown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.LookupAll(tt.lookup, tt.indexNames...)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			if assert.NoError(t, err) && assert.Len(t, got, len(tt.want)) {
+				for name, keys := range tt.want {
+					assert.ElementsMatch(t, keys, got[name], name)
+				}
+			}
+		})
+	}
+}
@@ -188,3 +188,243 @@ func TestDB_Lookup(t *testing.T) {
 	assert.Equal(t, "Millennial", collector[0])
 	assert.Equal(t, "OAP", collector[1])
 }
+
+func TestDB_Lookup_Blob(t *testing.T) {
+	d := testNewDB(t)
+	index, err := d.CreateIndex(&api.IndexDefinition{
+		Name: "hashed",
+		Fields: []*api.FieldDefinition{
+			{
+				Name:      "hash",
+				DataType:  &api.FieldDefinition_Scalar{Scalar: api.ScalarType_DATA_TYPE_BLOB},
+				IsPrimary: true,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashes := []string{"\x00\xff:\x10", "\x00\xff:\x11", "plain"}
+	for _, hash := range hashes {
+		_, err = index.InsertSegment(&api.Segment{
+			Fields: []*api.SegmentField{
+				{
+					Name:  "hash",
+					Value: &api.SegmentField_BlobValue{BlobValue: &api.SegmentFieldBlob{Value: hash}},
+				},
+			},
+		})
+		assert.NoError(t, err)
+	}
+
+	// Lookups match on the exact bytes
+	it, err := index.Lookup(&api.Lookup{
+		Fields: []*api.LookupField{
+			{
+				Name:  "hash",
+				Value: &api.LookupField_StringValue{StringValue: &api.SegmentFieldString{Value: hashes[1]}},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	collector := make([]string, 0)
+	for {
+		key, err := it.Next(nil)
+		if err == iterator.Done {
+			break
+		}
+		assert.NoError(t, err)
+		if err != nil {
+			break
+		}
+
+		collector = append(collector, key)
+	}
+
+	assert.Len(t, collector, 1)
+
+	// The primary key decodes back to the raw bytes
+	primary, err := index.UnmarshallPrimaryValue(collector[0])
+	assert.NoError(t, err)
+	assert.Equal(t, hashes[1], primary.GetBlobValue().GetValue())
+}
+
+func TestIterator_Close(t *testing.T) {
+	d := testNewDB(t)
+	index := testActiveIndex(t, d, 2*segmentBatch)
+
+	it, err := index.Lookup(&api.Lookup{Fields: []*api.LookupField{boolLookupField("active", true)}})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// The first result is returned while the rest of the lookup is pending
+	_, err = it.Next(nil)
+	assert.NoError(t, err)
+
+	// The results which have not been returned are dropped
+	it.Close()
+	_, err = it.Next(nil)
+	assert.ErrorIs(t, err, iterator.Done)
+
+	// Closing twice, or before the lookup started, does nothing
+	it.Close()
+	it, err = index.Lookup(&api.Lookup{Fields: []*api.LookupField{boolLookupField("active", true)}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	it.Close()
+	_, err = it.Next(nil)
+	assert.ErrorIs(t, err, iterator.Done)
+}
+
+func TestIterator_WriteDuringLookup(t *testing.T) {
+	// Each deleted segment is found in the second batch of the lookup
+	tests := []struct {
+		name    string
+		opts    []LookupOption
+		deleted string
+	}{
+		{name: "unordered", deleted: "segment-99"},
+		{name: "sorted", opts: []LookupOption{WithSort("", false)}, deleted: "segment-99"},
+		{name: "scored", opts: []LookupOption{WithScoring(1)}, deleted: "segment-11"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := testNewDB(t)
+			index := testActiveIndex(t, d, 2*segmentBatch)
+
+			lookup := &api.Lookup{Fields: []*api.LookupField{boolLookupField("active", true)}}
+			it, err := index.LookupSegments(lookup, tt.opts...)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			// Writes between calls to Next do not wait for the lookup, segments deleted before their batch is found
+			// are not returned
+			collector := make([]string, 0)
+			for {
+				segment := &api.Segment{}
+				key, err := it.Next(segment)
+				if err == iterator.Done {
+					break
+				}
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.Equal(t, key, segment.Fields[0].GetStringValue().GetValue())
+				assert.LessOrEqual(t, len(it.results), segmentBatch)
+				collector = append(collector, key)
+
+				if _, err = index.InsertSegment(getSingleFieldSegment("segment-new-" + key)); !assert.NoError(t, err) {
+					return
+				}
+				if len(collector) == 1 {
+					if _, err = index.DeleteSegment(tt.deleted); !assert.NoError(t, err) {
+						return
+					}
+				}
+			}
+
+			// 115 segments are active, one is deleted before the second batch is found
+			assert.Len(t, collector, 114)
+			assert.NotContains(t, collector, tt.deleted)
+		})
+	}
+}
+
+func TestIterator_PageBatches(t *testing.T) {
+	d := testNewDB(t)
+	index := testActiveIndex(t, d, 2*segmentBatch)
+	lookup := &api.Lookup{Fields: []*api.LookupField{boolLookupField("active", true)}}
+
+	// A page larger than a batch is found in several, only the last result of the page returns the cursor
+	it, err := index.Lookup(lookup, WithPage(segmentBatch+10, ""))
+	if !assert.NoError(t, err) {
+		return
+	}
+	for n := 0; n < segmentBatch+10; n++ {
+		_, err = it.Next(nil)
+		assert.NoError(t, err)
+		if n < segmentBatch+9 {
+			assert.Empty(t, it.Cursor())
+		}
+	}
+	if !assert.NotEmpty(t, it.Cursor()) {
+		return
+	}
+
+	it, err = index.Lookup(lookup, WithPage(segmentBatch, it.Cursor()))
+	if assert.NoError(t, err) {
+		assert.Len(t, testCollectKeys(t, it), 115-segmentBatch-10)
+		assert.Empty(t, it.Cursor())
+	}
+}
+
+func TestIndex_LookupSegments(t *testing.T) {
+	d := testNewDB(t)
+	index := testActiveIndex(t, d, 10)
+
+	it, err := index.LookupSegments(&api.Lookup{
+		Fields: []*api.LookupField{stringLookupField("name", "segment-4")},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	segment := &api.Segment{}
+	key, err := it.Next(segment)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "segment-4", key)
+	assert.Len(t, segment.GetFields(), 3)
+
+	_, err = it.Next(nil)
+	assert.ErrorIs(t, err, iterator.Done)
+}
+
+func TestIterator_Next_Repeated(t *testing.T) {
+	d := testNewDB(t)
+	index := testCategoryIndex(t, d, nil)
+	testInsertCategories(t, index)
+
+	football := testCategoryLookup("sports/football").Fields[0]
+	championship := testCategoryLookup("sports/football/championship").Fields[0]
+
+	tests := []struct {
+		name   string
+		fields []*api.LookupField
+		query  Query
+		want   []string
+	}{
+		{
+			name:   "segment holding several matching values",
+			fields: []*api.LookupField{championship},
+			want:   []string{"sports", "football"},
+		},
+		{
+			name:  "segment matched by several queries",
+			query: Or(Match(football), Match(championship)),
+			want:  []string{"sports", "football"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := make([]LookupOption, 0)
+			if tt.query != nil {
+				opts = append(opts, WithQuery(tt.query))
+			}
+
+			it, err := index.Lookup(&api.Lookup{Fields: tt.fields}, opts...)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			// Each segment is returned once
+			assert.ElementsMatch(t, tt.want, testCollectKeys(t, it))
+		})
+	}
+}
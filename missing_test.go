@@ -0,0 +1,171 @@
+package db
+
+import (
+	api "github.com/segmentq/protos-api-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDB_Lookup_MissingMatchesAny(t *testing.T) {
+	d := testNewDB(t)
+	index, err := d.CreateIndexWithOptions(&api.IndexDefinition{
+		Name: "audiences",
+		Fields: []*api.FieldDefinition{
+			{
+				Name:      "name",
+				DataType:  &api.FieldDefinition_Scalar{Scalar: api.ScalarType_DATA_TYPE_STRING},
+				IsPrimary: true,
+			},
+			scalarField("country", api.ScalarType_DATA_TYPE_STRING),
+			scalarField("device", api.ScalarType_DATA_TYPE_STRING),
+		},
+	}, map[string]*FieldOptions{
+		"country": {MissingMatchesAny: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	segments := map[string][]*api.SegmentField{
+		"gb-ios":      {stringSegmentField("country", "GB"), stringSegmentField("device", "ios")},
+		"any-ios":     {stringSegmentField("device", "ios")},
+		"fr-any":      {stringSegmentField("country", "FR")},
+		"any-android": {stringSegmentField("device", "android")},
+	}
+	for name, fields := range segments {
+		segment := getSingleFieldSegment(name)
+		segment.Fields = append(segment.Fields, fields...)
+		if _, err = index.InsertSegment(segment); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		fields []*api.LookupField
+		want   []string
+	}{
+		{
+			name:   "missing country matches any country",
+			fields: []*api.LookupField{stringLookupField("country", "GB")},
+			want:   []string{"gb-ios", "any-ios", "any-android"},
+		},
+		{
+			name:   "missing device does not match any device",
+			fields: []*api.LookupField{stringLookupField("country", "FR"), stringLookupField("device", "ios")},
+			want:   []string{"any-ios"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it, err := index.Lookup(&api.Lookup{Fields: tt.fields})
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.ElementsMatch(t, tt.want, testCollectKeys(t, it))
+		})
+	}
+
+	// Deleting a segment removes its marker
+	_, err = index.DeleteSegment("any-ios")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	it, err := index.Lookup(&api.Lookup{Fields: []*api.LookupField{stringLookupField("country", "DE")}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.ElementsMatch(t, []string{"any-android"}, testCollectKeys(t, it))
+
+	// Inserting a segment again with the field removes its marker
+	segment := getSingleFieldSegment("any-android")
+	segment.Fields = append(segment.Fields, stringSegmentField("country", "GB"), stringSegmentField("device", "android"))
+	if _, err = index.InsertSegment(segment); !assert.NoError(t, err) {
+		return
+	}
+
+	it, err = index.Lookup(&api.Lookup{Fields: []*api.LookupField{stringLookupField("country", "DE")}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Empty(t, testCollectKeys(t, it))
+}
+
+func TestDB_Lookup_MissingMatchesAny_FieldCase(t *testing.T) {
+	d := testNewDB(t)
+	index, err := d.CreateIndexWithOptions(&api.IndexDefinition{
+		Name: "regions",
+		Fields: []*api.FieldDefinition{
+			{
+				Name:      "name",
+				DataType:  &api.FieldDefinition_Scalar{Scalar: api.ScalarType_DATA_TYPE_STRING},
+				IsPrimary: true,
+			},
+			scalarField("region", api.ScalarType_DATA_TYPE_STRING),
+			scalarField("Region", api.ScalarType_DATA_TYPE_STRING),
+		},
+	}, map[string]*FieldOptions{
+		"region": {MissingMatchesAny: true},
+		"Region": {MissingMatchesAny: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each segment is marked only for the field it omits
+	segments := map[string]*api.SegmentField{
+		"lower": stringSegmentField("region", "north"),
+		"upper": stringSegmentField("Region", "north"),
+	}
+	for name, field := range segments {
+		segment := getSingleFieldSegment(name)
+		segment.Fields = append(segment.Fields, field)
+		if _, err = index.InsertSegment(segment); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	it, err := index.Lookup(&api.Lookup{Fields: []*api.LookupField{stringLookupField("region", "south")}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"upper"}, testCollectKeys(t, it))
+	}
+
+	it, err = index.Lookup(&api.Lookup{Fields: []*api.LookupField{stringLookupField("Region", "south")}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"lower"}, testCollectKeys(t, it))
+	}
+
+	// Only the marker of the field looked up is scanned
+	x, err := index.Explain(&api.Lookup{Fields: []*api.LookupField{stringLookupField("region", "south")}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(1), x.Scanned)
+	}
+}
+
+func TestDB_CreateIndexWithOptions_MissingMatchesAny(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *FieldOptions
+	}{
+		{name: "required", options: &FieldOptions{MissingMatchesAny: true, Required: true}},
+		{name: "not indexed", options: &FieldOptions{MissingMatchesAny: true, NotIndexed: true}},
+		{
+			name: "default",
+			options: &FieldOptions{
+				MissingMatchesAny: true,
+				Default:           stringSegmentField("country", "GB"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := testNewDB(t)
+			definition := getAudienceIndex("audiences")
+			definition.Fields = append(definition.Fields, scalarField("country", api.ScalarType_DATA_TYPE_STRING))
+
+			_, err := d.CreateIndexWithOptions(definition, map[string]*FieldOptions{"country": tt.options})
+			assert.ErrorIs(t, err, ErrInvalidFieldOptions)
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package db
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	api "github.com/segmentq/protos-api-go"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Network field types are set in the FieldOptions of STRING and RANGE fields
+const (
+	// FieldTypeIP STRING fields take IPv4 or IPv6 addresses as a StringValue
+	FieldTypeIP FieldType = "ip"
+	// FieldTypeCIDR RANGE fields take CIDR blocks or single addresses as a StringValue, lookups find the blocks
+	// containing an IP
+	FieldTypeCIDR FieldType = "cidr"
+)
+
+// cidrDimensions splits the 128 bits of an address into 32 bit dimensions which a float64 holds exactly
+const cidrDimensions = 4
+
+// isIPScalar reports whether the field holds single IP addresses
+func isIPScalar(definition *api.FieldDefinition, fieldType FieldType) bool {
+	_, ok := definition.GetDataType().(*api.FieldDefinition_Scalar)
+	return ok && fieldType == FieldTypeIP
+}
+
+// isCIDRRange reports whether the field holds CIDR blocks
+func isCIDRRange(definition *api.FieldDefinition, fieldType FieldType) bool {
+	_, ok := definition.GetDataType().(*api.FieldDefinition_Geo)
+	return ok && fieldType == FieldTypeCIDR
+}
+
+// parsePrefix reads a CIDR block, a single address is treated as a block of one address
+func parsePrefix(value string) (netip.Prefix, error) {
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// prefixBounds returns the first and last address of a block as IPv6, IPv4 blocks are mapped into IPv6
+func prefixBounds(prefix netip.Prefix) (first [16]byte, last [16]byte) {
+	bits := prefix.Bits()
+	if prefix.Addr().Is4() {
+		bits += 96
+	}
+
+	first = prefix.Addr().As16()
+	last = first
+	for bit := bits; bit < 128; bit++ {
+		last[bit/8] |= 0x80 >> (bit % 8)
+	}
+	return first, last
+}
+
+// ipKey encodes an address so a binary comparison matches the address order, IPv4 addresses are mapped into IPv6
+func ipKey(addr netip.Addr) string {
+	b := addr.As16()
+	return hex.EncodeToString(b[:])
+}
+
+// cidrPoint encodes a single address of a block in the dimensions used by the spatial index
+func cidrPoint(b [16]byte) string {
+	coordinates := make([]string, 0, cidrDimensions)
+	for n := 0; n < cidrDimensions; n++ {
+		coordinates = append(coordinates, strconv.FormatUint(uint64(binary.BigEndian.Uint32(b[n*4:])), 10))
+	}
+	return "[" + strings.Join(coordinates, " ") + "]"
+}
+
+// cidrRect encodes a block as the rect from its first to its last address
+func cidrRect(prefix netip.Prefix) string {
+	first, last := prefixBounds(prefix)
+	return cidrPoint(first) + "," + cidrPoint(last)
+}
+
+// checkNetworkValues ensures every value is an address, or a block when blocks are allowed
+func checkNetworkValues(definition *api.FieldDefinition, values []string, blocks bool) error {
+	for _, value := range values {
+		var err error
+		if blocks {
+			_, err = parsePrefix(value)
+		} else {
+			_, err = netip.ParseAddr(value)
+		}
+
+		if err != nil {
+			return fmt.Errorf("%w: field %q cannot parse %q", ErrTypeMismatch, definition.Name, value)
+		}
+	}
+	return nil
+}
+
+// checkNetworkSegmentField ensures IP fields hold addresses and CIDR fields hold blocks or addresses
+func checkNetworkSegmentField(definition *api.FieldDefinition, fieldType FieldType,
+	field *api.SegmentField) (*api.SegmentField, error) {
+	values, ok := stringValues(field)
+	if !ok {
+		return nil, typeMismatch(definition)
+	}
+
+	if err := checkNetworkValues(definition, values, isCIDRRange(definition, fieldType)); err != nil {
+		return nil, err
+	}
+	return field, nil
+}
+
+// checkNetworkLookupField allows a single CIDR block to be looked up in an IP field, and addresses or blocks to be
+// looked up in a CIDR field
+func checkNetworkLookupField(definition *api.FieldDefinition, fieldType FieldType,
+	field *api.LookupField) (*api.LookupField, bool, error) {
+	if !isIPScalar(definition, fieldType) && !isCIDRRange(definition, fieldType) {
+		return nil, false, nil
+	}
+
+	segmentField, ok := lookupToSegmentField(field)
+	if !ok {
+		return nil, true, typeMismatch(definition)
+	}
+
+	values, ok := stringValues(segmentField)
+	if !ok {
+		return nil, true, typeMismatch(definition)
+	}
+
+	// A block within an IP field is a range scan, which can only be done for a single value
+	_, single := field.Value.(*api.LookupField_StringValue)
+	if err := checkNetworkValues(definition, values, isCIDRRange(definition, fieldType) || single); err != nil {
+		return nil, true, err
+	}
+	return field, true, nil
+}
+
+// isIPBetween reports whether a lookup asks for the addresses of an IP field within a block
+func isIPBetween(definition *api.FieldDefinition, fieldType FieldType, field *api.LookupField) bool {
+	_, ok := field.Value.(*api.LookupField_StringValue)
+	return ok && isIPScalar(definition, fieldType) && strings.Contains(field.GetStringValue().Value, "/")
+}
+
+// ipBetween returns the inclusive greater or equal and exclusive less than pivots for the addresses within a block
+func ipBetween(field *api.LookupField) (string, string, error) {
+	prefix, err := parsePrefix(field.GetStringValue().Value)
+	if err != nil {
+		return "", "", ErrLookupFailure
+	}
+
+	first, last := prefixBounds(prefix)
+
+	// Keys are a fixed length, so the last key with any suffix sorts after it and before the next address
+	return hex.EncodeToString(first[:]), hex.EncodeToString(last[:]) + "0", nil
+}
+
+func stringValues(field *api.SegmentField) ([]string, bool) {
+	switch field.Value.(type) {
+	case *api.SegmentField_StringValue:
+		return []string{field.GetStringValue().Value}, true
+	case *api.SegmentField_RepeatedStringValue:
+		return field.GetRepeatedStringValue().Value, true
+	}
+	return nil, false
+}
+
+// marshallNetwork writes addresses in their sortable form and blocks as rects
+func (s *Stringer) marshallNetwork() error {
+	field := s.segmentField
+	if field == nil {
+		converted, ok := lookupToSegmentField(s.lookupField)
+		if !ok {
+			return ErrFieldUnknown
+		}
+		field = converted
+	}
+
+	values, ok := stringValues(field)
+	if !ok {
+		return ErrFieldUnknown
+	}
+
+	for key, value := range values {
+		var encoded string
+		if isCIDRRange(s.fieldDefinition, s.fieldType) {
+			prefix, err := parsePrefix(value)
+			if err != nil {
+				return err
+			}
+			encoded = cidrRect(prefix)
+		} else {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return err
+			}
+			encoded = ipKey(addr)
+		}
+
+		if !s.iter(strconv.Itoa(key), encoded) {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *Stringer) toIPField(value string) (*api.SegmentField, error) {
+	decoded, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	addr, ok := netip.AddrFromSlice(decoded)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q is not a valid address", ErrMarshallingFailed, value)
+	}
+
+	return &api.SegmentField{
+		Name: s.fieldDefinition.Name,
+		Value: &api.SegmentField_StringValue{
+			StringValue: &api.SegmentFieldString{
+				Value: addr.Unmap().String(),
+			},
+		},
+	}, nil
+}
+
+func (s *Stringer) toCIDRField(value string) (*api.SegmentField, error) {
+	points, err := parseRectN(value, cidrDimensions)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(points) != 2 {
+		return nil, fmt.Errorf("%w: %q is not a valid block", ErrMarshallingFailed, value)
+	}
+
+	var first, last [16]byte
+	for n := 0; n < cidrDimensions; n++ {
+		lower, err := strconv.ParseUint(points[0][n], 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		upper, err := strconv.ParseUint(points[1][n], 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		binary.BigEndian.PutUint32(first[n*4:], uint32(lower))
+		binary.BigEndian.PutUint32(last[n*4:], uint32(upper))
+	}
+
+	// The prefix length is the number of leading bits the first and last address share
+	bits := 0
+	for bits < 128 && first[bits/8]&(0x80>>(bits%8)) == last[bits/8]&(0x80>>(bits%8)) {
+		bits++
+	}
+
+	addr := netip.AddrFrom16(first)
+	if addr.Is4In6() && bits >= 96 {
+		addr = addr.Unmap()
+		bits -= 96
+	}
+
+	return &api.SegmentField{
+		Name: s.fieldDefinition.Name,
+		Value: &api.SegmentField_StringValue{
+			StringValue: &api.SegmentFieldString{
+				Value: netip.PrefixFrom(addr, bits).String(),
+			},
+		},
+	}, nil
+}
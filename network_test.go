@@ -0,0 +1,216 @@
+package db
+
+import (
+	"fmt"
+	api "github.com/segmentq/protos-api-go"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func testNetworkIndex(t *testing.T, db *DB) *Index {
+	index, err := db.CreateIndexWithOptions(&api.IndexDefinition{
+		Name: "networks",
+		Fields: []*api.FieldDefinition{
+			{
+				Name:      "name",
+				DataType:  &api.FieldDefinition_Scalar{Scalar: api.ScalarType_DATA_TYPE_STRING},
+				IsPrimary: true,
+			},
+			scalarField("gateway", api.ScalarType_DATA_TYPE_STRING),
+			geoField("blocks", api.GeoType_DATA_TYPE_RANGE),
+		},
+	}, map[string]*FieldOptions{
+		"gateway": {Type: FieldTypeIP},
+		"blocks":  {Type: FieldTypeCIDR},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return index
+}
+
+func getNetworkSegment(name, gateway string, blocks ...string) *api.Segment {
+	return &api.Segment{
+		Fields: []*api.SegmentField{
+			{
+				Name:  "name",
+				Value: &api.SegmentField_StringValue{StringValue: &api.SegmentFieldString{Value: name}},
+			},
+			{
+				Name:  "gateway",
+				Value: &api.SegmentField_StringValue{StringValue: &api.SegmentFieldString{Value: gateway}},
+			},
+			{
+				Name:  "blocks",
+				Value: &api.SegmentField_RepeatedStringValue{RepeatedStringValue: &api.SegmentFieldRepeatedString{Value: blocks}},
+			},
+		},
+	}
+}
+
+func TestDB_Lookup_Network(t *testing.T) {
+	d := testNewDB(t)
+	index := testNetworkIndex(t, d)
+
+	_, err := index.InsertSegment(getNetworkSegment("office", "10.0.0.1", "10.0.0.0/8", "192.168.1.0/24"))
+	assert.NoError(t, err)
+
+	_, err = index.InsertSegment(getNetworkSegment("datacenter", "172.16.0.1", "172.16.0.0/12", "2001:db8::/32"))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		field *api.LookupField
+		want  []string
+	}{
+		{
+			name: "block contains an IPv4 address",
+			field: &api.LookupField{
+				Name:  "blocks",
+				Value: &api.LookupField_StringValue{StringValue: &api.SegmentFieldString{Value: "192.168.1.42"}},
+			},
+			want: []string{"office"},
+		},
+		{
+			name: "block contains an IPv6 address",
+			field: &api.LookupField{
+				Name:  "blocks",
+				Value: &api.LookupField_StringValue{StringValue: &api.SegmentFieldString{Value: "2001:db8::1"}},
+			},
+			want: []string{"datacenter"},
+		},
+		{
+			name: "no block contains the address",
+			field: &api.LookupField{
+				Name:  "blocks",
+				Value: &api.LookupField_StringValue{StringValue: &api.SegmentFieldString{Value: "8.8.8.8"}},
+			},
+			want: []string{},
+		},
+		{
+			name: "exact address",
+			field: &api.LookupField{
+				Name:  "gateway",
+				Value: &api.LookupField_StringValue{StringValue: &api.SegmentFieldString{Value: "172.16.0.1"}},
+			},
+			want: []string{"datacenter"},
+		},
+		{
+			name: "addresses within a block",
+			field: &api.LookupField{
+				Name:  "gateway",
+				Value: &api.LookupField_StringValue{StringValue: &api.SegmentFieldString{Value: "10.0.0.0/24"}},
+			},
+			want: []string{"office"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it, err := index.Lookup(&api.Lookup{Fields: []*api.LookupField{tt.field}})
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equalf(t, tt.want, testCollectKeys(t, it), fmt.Sprintf("Lookup(%v)", tt.field))
+		})
+	}
+}
+
+func TestIndex_InsertSegment_InvalidNetwork(t *testing.T) {
+	d := testNewDB(t)
+	index := testNetworkIndex(t, d)
+
+	_, err := index.InsertSegment(getNetworkSegment("broken", "10.0.0.0/8", "10.0.0.0/8"))
+	assert.ErrorIs(t, err, ErrTypeMismatch)
+	assert.Contains(t, err.Error(), "gateway")
+
+	_, err = index.InsertSegment(getNetworkSegment("broken", "10.0.0.1", "10.0.0.0/33"))
+	assert.ErrorIs(t, err, ErrTypeMismatch)
+	assert.Contains(t, err.Error(), "blocks")
+}
+
+func TestDB_Lookup_NetworkReopened(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "segments.db")
+	d := testReopenDB(t, path, nil)
+
+	_, err := testNetworkIndex(t, d).InsertSegment(getNetworkSegment("office", "10.0.0.1", "10.0.0.0/8"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	index, err := testReopenDB(t, path, d).GetIndexByName("networks")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for name, want := range map[string]FieldType{"gateway": FieldTypeIP, "blocks": FieldTypeCIDR} {
+		options, err := index.FieldOptions(name)
+		if assert.NoError(t, err) {
+			assert.Equal(t, want, options.Type)
+		}
+	}
+
+	for _, field := range []*api.LookupField{
+		{Name: "gateway", Value: &api.LookupField_StringValue{StringValue: &api.SegmentFieldString{Value: "10.0.0.0/24"}}},
+		{Name: "blocks", Value: &api.LookupField_StringValue{StringValue: &api.SegmentFieldString{Value: "10.1.2.3"}}},
+	} {
+		it, err := index.Lookup(&api.Lookup{Fields: []*api.LookupField{field}})
+		if assert.NoError(t, err) {
+			assert.Equal(t, []string{"office"}, testCollectKeys(t, it), field.Name)
+		}
+	}
+}
+
+func TestDB_CreateIndexWithOptions_NetworkType(t *testing.T) {
+	d := testNewDB(t)
+
+	_, err := d.CreateIndexWithOptions(&api.IndexDefinition{
+		Name:   "addresses",
+		Fields: []*api.FieldDefinition{scalarField("gateway", api.ScalarType_DATA_TYPE_INT64)},
+	}, map[string]*FieldOptions{"gateway": {Type: FieldTypeIP}})
+	assert.ErrorIs(t, err, ErrInvalidFieldOptions)
+
+	_, err = d.CreateIndexWithOptions(&api.IndexDefinition{
+		Name:   "addresses",
+		Fields: []*api.FieldDefinition{scalarField("gateway", api.ScalarType_DATA_TYPE_STRING)},
+	}, map[string]*FieldOptions{"gateway": {Type: FieldTypeIP, Collation: &Collation{FoldCase: true}}})
+	assert.ErrorIs(t, err, ErrInvalidFieldOptions)
+}
+
+func TestStringer_toNetworkField(t *testing.T) {
+	tests := []struct {
+		name       string
+		definition *api.FieldDefinition
+		fieldType  FieldType
+		value      string
+	}{
+		{name: "IPv4 address", definition: scalarField("gateway", api.ScalarType_DATA_TYPE_STRING), fieldType: FieldTypeIP, value: "10.0.0.1"},
+		{name: "IPv6 address", definition: scalarField("gateway", api.ScalarType_DATA_TYPE_STRING), fieldType: FieldTypeIP, value: "2001:db8::1"},
+		{name: "IPv4 block", definition: geoField("blocks", api.GeoType_DATA_TYPE_RANGE), fieldType: FieldTypeCIDR, value: "192.168.1.0/24"},
+		{name: "IPv6 block", definition: geoField("blocks", api.GeoType_DATA_TYPE_RANGE), fieldType: FieldTypeCIDR, value: "2001:db8::/32"},
+		{name: "single address block", definition: geoField("blocks", api.GeoType_DATA_TYPE_RANGE), fieldType: FieldTypeCIDR, value: "10.0.0.1/32"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			field := &api.SegmentField{
+				Name:  tt.definition.Name,
+				Value: &api.SegmentField_StringValue{StringValue: &api.SegmentFieldString{Value: tt.value}},
+			}
+
+			var encoded string
+			err := NewSegmentStringer(field, func(_, value string) bool {
+				encoded = value
+				return true
+			}).withDefinition(tt.definition).withType(tt.fieldType).MarshallText()
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			got, err := NewFieldDefinitionStringer(tt.definition).withType(tt.fieldType).UnmarshallText(encoded)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.value, got.GetStringValue().GetValue())
+		})
+	}
+}
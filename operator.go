@@ -0,0 +1,406 @@
+package db
+
+import (
+	"fmt"
+	api "github.com/segmentq/protos-api-go"
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/match"
+	"regexp"
+	"strings"
+)
+
+// Operator compares the values of a lookup field with the values held by segments
+type Operator int
+
+const (
+	// OperatorEqual matches segments holding one of the lookup values, it is used when no operator is set
+	OperatorEqual Operator = iota
+	// OperatorPrefix matches string values which start with the lookup value, ignoring case like equality does
+	OperatorPrefix
+	// OperatorWildcard matches string values against a glob, "*" matches any run of characters and "?" any one.
+	// Case is ignored like equality does.
+	OperatorWildcard
+	// OperatorRegex matches string values against an RE2 regular expression, ignoring case like equality does unless
+	// the expression clears the flag with (?-i)
+	OperatorRegex
+	// OperatorLess matches values less than the lookup value
+	OperatorLess
+	// OperatorLessOrEqual matches values less than or equal to the lookup value
+	OperatorLessOrEqual
+	// OperatorGreater matches values greater than the lookup value
+	OperatorGreater
+	// OperatorGreaterOrEqual matches values greater than or equal to the lookup value
+	OperatorGreaterOrEqual
+	// OperatorBetween matches values from the min to the max of the lookup value inclusive, given as a range or as
+	// a repeated value of two
+	OperatorBetween
+	// OperatorNotEqual matches segments which hold the field but none of the lookup values
+	OperatorNotEqual
+)
+
+var operatorNames = map[Operator]string{
+	OperatorEqual:          "equal",
+	OperatorPrefix:         "prefix",
+	OperatorWildcard:       "wildcard",
+	OperatorRegex:          "regex",
+	OperatorLess:           "<",
+	OperatorLessOrEqual:    "<=",
+	OperatorGreater:        ">",
+	OperatorGreaterOrEqual: ">=",
+	OperatorBetween:        "between",
+	OperatorNotEqual:       "!=",
+}
+
+func (o Operator) String() string {
+	if name, ok := operatorNames[o]; ok {
+		return name
+	}
+	return fmt.Sprintf("operator(%d)", int(o))
+}
+
+// checkOperator ensures an operator can be used on the field it is applied to
+func checkOperator(definition *api.FieldDefinition, options *FieldOptions, operator Operator) error {
+	switch operator {
+	case OperatorEqual:
+		return nil
+	case OperatorPrefix, OperatorWildcard, OperatorRegex:
+		if isStringScalar(definition) && options.fieldType() == "" {
+			return nil
+		}
+	case OperatorLess, OperatorLessOrEqual, OperatorGreater, OperatorGreaterOrEqual, OperatorBetween,
+		OperatorNotEqual:
+		if isOrderedScalar(definition, options.fieldType()) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s cannot be used on field %q of %s", ErrInvalidOperator, operator, definition.Name,
+		fieldTypeName(definition, options.fieldType()))
+}
+
+// isOrderedScalar reports whether the field index orders values by their number or text, not their bytes
+func isOrderedScalar(definition *api.FieldDefinition, fieldType FieldType) bool {
+	if _, ok := definition.GetDataType().(*api.FieldDefinition_Scalar); !ok {
+		return false
+	}
+
+	switch definition.GetScalar() {
+	case api.ScalarType_DATA_TYPE_BOOL, api.ScalarType_DATA_TYPE_BLOB:
+		return false
+	}
+	if fieldType == FieldTypeIP || fieldType == FieldTypePath {
+		return false
+	}
+	_, ok := scalarLess(definition, fieldType)
+	return ok
+}
+
+// betweenField converts a range lookup into the repeated min and max used to check and encode the bounds
+func betweenField(field *api.LookupField) *api.LookupField {
+	switch field.Value.(type) {
+	case *api.LookupField_RangeIntValue:
+		value := field.GetRangeIntValue()
+		return &api.LookupField{
+			Name: field.Name,
+			Value: &api.LookupField_RepeatedIntValue{
+				RepeatedIntValue: &api.SegmentFieldRepeatedInt{Value: []int64{value.Min, value.Max}},
+			},
+		}
+	case *api.LookupField_RangeFloatValue:
+		value := field.GetRangeFloatValue()
+		return &api.LookupField{
+			Name: field.Name,
+			Value: &api.LookupField_RepeatedFloatValue{
+				RepeatedFloatValue: &api.SegmentFieldRepeatedFloat{Value: []float64{value.Min, value.Max}},
+			},
+		}
+	}
+	return field
+}
+
+// scanOperator visits the keys in the field index which match the lookup values with the operator
+func scanOperator(tx *buntdb.Tx, index string, definition *api.FieldDefinition, field *api.LookupField,
+	operator Operator, options *FieldOptions, iter func(key, value string) bool) error {
+	switch operator {
+	case OperatorPrefix, OperatorWildcard, OperatorRegex:
+		return scanPatterns(tx, index, definition, field, operator, options.collation(), iter)
+	}
+
+	// Comparisons use the lookup values as they are written to the index
+	pivots, err := lookupPivots(definition, field, options)
+	if err != nil {
+		return err
+	}
+
+	less, _ := scalarLess(definition, options.fieldType())
+	if err = scanComparison(tx, index, less, operator, pivots, iter); err == buntdb.ErrNotFound {
+		return ErrLookupFailure
+	}
+	return err
+}
+
+// lookupPivots encodes the lookup values as they are written to the field index
+func lookupPivots(definition *api.FieldDefinition, field *api.LookupField, options *FieldOptions) ([]string, error) {
+	pivots := make([]string, 0)
+	err := NewLookupStringer(field, func(_, value string) bool {
+		pivots = append(pivots, value)
+		return true
+	}).withDefinition(definition).withType(options.fieldType()).withCollation(options.collation()).MarshallText()
+	if err != nil {
+		return nil, ErrLookupFailure
+	}
+
+	return pivots, nil
+}
+
+// checkPivots ensures the operator is given as many lookup values as it compares with, and that a between is not
+// given its max before its min
+func checkPivots(less func(a, b string) bool, operator Operator, pivots []string) error {
+	want := 1
+	switch operator {
+	case OperatorNotEqual:
+		return nil
+	case OperatorBetween:
+		want = 2
+	}
+	if len(pivots) != want {
+		return fmt.Errorf("%w: %s takes %d values, not %d", ErrInvalidOperator, operator, want, len(pivots))
+	}
+	if operator == OperatorBetween && less(pivots[1], pivots[0]) {
+		return fmt.Errorf("%w: %s takes its min before its max", ErrInvalidOperator, operator)
+	}
+	return nil
+}
+
+// compareValue returns a test of index values which is true for the values scanComparison visits
+func compareValue(less func(a, b string) bool, operator Operator, pivots []string) (func(value string) bool, error) {
+	if err := checkPivots(less, operator, pivots); err != nil {
+		return nil, err
+	}
+
+	switch operator {
+	case OperatorNotEqual:
+		return func(value string) bool { return !equalsAny(less, value, pivots) }, nil
+	case OperatorLess:
+		return func(value string) bool { return less(value, pivots[0]) }, nil
+	case OperatorLessOrEqual:
+		return func(value string) bool { return !less(pivots[0], value) }, nil
+	case OperatorGreater:
+		return func(value string) bool { return less(pivots[0], value) }, nil
+	case OperatorGreaterOrEqual:
+		return func(value string) bool { return !less(value, pivots[0]) }, nil
+	case OperatorBetween:
+		return func(value string) bool { return !less(value, pivots[0]) && !less(pivots[1], value) }, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrInvalidOperator, operator)
+}
+
+// equalsAny reports whether the value is equal to one of the pivots as the field index compares them
+func equalsAny(less func(a, b string) bool, value string, pivots []string) bool {
+	for _, pivot := range pivots {
+		if !less(value, pivot) && !less(pivot, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanComparison visits the part of the ordered index on the side of the pivots the operator asks for
+func scanComparison(tx *buntdb.Tx, index string, less func(a, b string) bool, operator Operator,
+	pivots []string, iter func(key, value string) bool) error {
+	if operator == OperatorNotEqual {
+		return scanNotEqual(tx, index, pivots, iter)
+	}
+
+	if err := checkPivots(less, operator, pivots); err != nil {
+		return err
+	}
+
+	pivot := pivots[0]
+	switch operator {
+	case OperatorLess:
+		return tx.AscendLessThan(index, pivot, iter)
+	case OperatorLessOrEqual:
+		if err := tx.AscendLessThan(index, pivot, iter); err != nil {
+			return err
+		}
+		return tx.AscendEqual(index, pivot, iter)
+	case OperatorGreater:
+		return tx.DescendGreaterThan(index, pivot, iter)
+	case OperatorGreaterOrEqual:
+		return tx.AscendGreaterOrEqual(index, pivot, iter)
+	case OperatorBetween:
+		if err := tx.AscendRange(index, pivot, pivots[1], iter); err != nil {
+			return err
+		}
+		return tx.AscendEqual(index, pivots[1], iter)
+	}
+
+	return fmt.Errorf("%w: %s", ErrInvalidOperator, operator)
+}
+
+// scanNotEqual visits the segments which hold a value for the field but none of the pivots
+func scanNotEqual(tx *buntdb.Tx, index string, pivots []string, iter func(key, value string) bool) error {
+	excluded := make(map[string]bool)
+	for _, pivot := range pivots {
+		err := tx.AscendEqual(index, pivot, func(key, _ string) bool {
+			keyObject := keyFromString(key)
+			if k, ok := keyObject.SegmentKey(); ok {
+				excluded[k] = true
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Ascend(index, func(key, value string) bool {
+		keyObject := keyFromString(key)
+		if k, ok := keyObject.SegmentKey(); ok && excluded[k] {
+			return true
+		}
+		return iter(key, value)
+	})
+}
+
+// pattern is a string lookup value which is matched by a scan of the values starting with its literal prefix
+type pattern struct {
+	prefix  string
+	matches func(value string) bool
+}
+
+// visits reports whether the pattern scan visits a value of the ordered index
+func (p pattern) visits(value string) bool {
+	return hasPrefixFold(value, p.prefix) && p.matches(value)
+}
+
+// lookupPatterns returns the pattern of each value of a prefix, wildcard or regex lookup
+func lookupPatterns(definition *api.FieldDefinition, field *api.LookupField, operator Operator,
+	collation *Collation) ([]pattern, error) {
+	segmentField, ok := lookupToSegmentField(field)
+	if !ok {
+		return nil, typeMismatch(definition)
+	}
+
+	values, ok := stringValues(segmentField)
+	if !ok {
+		return nil, typeMismatch(definition)
+	}
+
+	patterns := make([]pattern, 0, len(values))
+	for _, value := range values {
+		var p pattern
+
+		switch operator {
+		case OperatorPrefix:
+			p.prefix = collation.apply(value)
+			p.matches = func(string) bool { return true }
+		case OperatorWildcard:
+			glob := lowerASCII(collation.apply(value))
+			p.prefix = glob[:literalLength(glob)]
+			p.matches = func(value string) bool { return match.Match(lowerASCII(value), glob) }
+		case OperatorRegex:
+			// Collation is not applied to expressions as folding would change escapes such as \S
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidOperator, err)
+			}
+			// Expressions are unanchored, so the literal prefix only bounds the scan when they begin with ^. The scan
+			// ignores case, so the prefix is taken before the expression is made to.
+			if strings.HasPrefix(value, "^") {
+				p.prefix, _ = re.LiteralPrefix()
+			}
+			folded, err := regexp.Compile("(?i)" + value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidOperator, err)
+			}
+			p.matches = folded.MatchString
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrInvalidOperator, operator)
+		}
+
+		patterns = append(patterns, p)
+	}
+
+	return patterns, nil
+}
+
+// scanPatterns visits the string values which match the patterns, bounded by their literal prefix so only a part of
+// the ordered index is scanned
+func scanPatterns(tx *buntdb.Tx, index string, definition *api.FieldDefinition, field *api.LookupField,
+	operator Operator, collation *Collation, iter func(key, value string) bool) error {
+	patterns, err := lookupPatterns(definition, field, operator, collation)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range patterns {
+		if err := scanPrefix(tx, index, p.prefix, p.matches, iter); err != nil {
+			return ErrLookupFailure
+		}
+	}
+
+	return nil
+}
+
+// scanPrefix visits the values of an ordered string index which start with prefix and are accepted by matches
+func scanPrefix(tx *buntdb.Tx, index string, prefix string, matches func(value string) bool,
+	iter func(key, value string) bool) error {
+	visit := func(key, value string) bool {
+		if !hasPrefixFold(value, prefix) {
+			return false
+		}
+		if matches(value) {
+			return iter(key, value)
+		}
+		return true
+	}
+
+	if prefix == "" {
+		return tx.Ascend(index, visit)
+	}
+	return tx.AscendGreaterOrEqual(index, prefix, visit)
+}
+
+// literalLength returns the length of the glob before its first wildcard or escape
+func literalLength(pattern string) int {
+	if n := strings.IndexAny(pattern, `*?\`); n != -1 {
+		return n
+	}
+	return len(pattern)
+}
+
+// lowerASCII lowers the ASCII letters of a string, which buntdb.IndexString compares without case
+func lowerASCII(s string) string {
+	b := []byte(s)
+	for n, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			b[n] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
+
+// hasPrefixFold reports whether value starts with prefix, ASCII letters are compared without case as
+// buntdb.IndexString orders them
+func hasPrefixFold(value, prefix string) bool {
+	if len(value) < len(prefix) {
+		return false
+	}
+
+	for n := 0; n < len(prefix); n++ {
+		a, b := value[n], prefix[n]
+		if a >= 'A' && a <= 'Z' {
+			a += 'a' - 'A'
+		}
+		if b >= 'A' && b <= 'Z' {
+			b += 'a' - 'A'
+		}
+		if a != b {
+			return false
+		}
+	}
+	return true
+}
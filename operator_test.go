@@ -0,0 +1,300 @@
+package db
+
+import (
+	api "github.com/segmentq/protos-api-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func testInsertNames(t *testing.T, index *Index, names ...string) {
+	for _, name := range names {
+		if _, err := index.InsertSegment(getSingleFieldSegment(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func testNameLookup(value string) *api.Lookup {
+	return &api.Lookup{
+		Fields: []*api.LookupField{
+			{
+				Name:  "name",
+				Value: &api.LookupField_StringValue{StringValue: &api.SegmentFieldString{Value: value}},
+			},
+		},
+	}
+}
+
+func TestDB_Lookup_StringOperators(t *testing.T) {
+	d := testNewDB(t)
+	index, err := d.CreateIndex(getSingleFieldIndex("names"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testInsertNames(t, index, "brand-shoes-retarget", "Brand-hats-retarget", "brand-shoes-prospect", "branding", "apple",
+		"retarget")
+
+	tests := []struct {
+		name     string
+		operator Operator
+		value    string
+		want     []string
+	}{
+		{
+			name:     "prefix ignores case",
+			operator: OperatorPrefix,
+			value:    "brand-",
+			want:     []string{"brand-shoes-retarget", "Brand-hats-retarget", "brand-shoes-prospect"},
+		},
+		{
+			name:     "wildcard ignores case",
+			operator: OperatorWildcard,
+			value:    "BRAND-*-retarget",
+			want:     []string{"brand-shoes-retarget", "Brand-hats-retarget"},
+		},
+		{
+			name:     "wildcard without a literal prefix",
+			operator: OperatorWildcard,
+			value:    "*-retarget",
+			want:     []string{"brand-shoes-retarget", "Brand-hats-retarget"},
+		},
+		{
+			name:     "regex ignores case",
+			operator: OperatorRegex,
+			value:    "^BRAND-shoes-",
+			want:     []string{"brand-shoes-retarget", "brand-shoes-prospect"},
+		},
+		{
+			name:     "regex matching case",
+			operator: OperatorRegex,
+			value:    "(?-i)^Brand-",
+			want:     []string{"Brand-hats-retarget"},
+		},
+		{
+			name:     "unanchored regex",
+			operator: OperatorRegex,
+			value:    "retarget",
+			want:     []string{"brand-shoes-retarget", "Brand-hats-retarget", "retarget"},
+		},
+		{
+			name:     "regex",
+			operator: OperatorRegex,
+			value:    "^(?i)brand-(hats|shoes)-retarget$",
+			want:     []string{"brand-shoes-retarget", "Brand-hats-retarget"},
+		},
+		{
+			name:     "regex with a literal prefix",
+			operator: OperatorRegex,
+			value:    "^brand-shoes-.+",
+			want:     []string{"brand-shoes-retarget", "brand-shoes-prospect"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it, err := index.Lookup(testNameLookup(tt.value), WithOperator("name", tt.operator))
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			assert.ElementsMatchf(t, tt.want, testCollectKeys(t, it), "Lookup(%s %s)", tt.operator, tt.value)
+		})
+	}
+}
+
+func TestDB_Lookup_InvalidOperator(t *testing.T) {
+	d := testNewDB(t)
+	index := testCategoryIndex(t, d, nil)
+	testInsertCategories(t, index)
+
+	it, err := index.Lookup(testCategoryLookup("sports"), WithOperator("category", OperatorRegex))
+	assert.NoError(t, err)
+
+	_, err = it.Next(nil)
+	assert.ErrorIs(t, err, ErrInvalidOperator)
+}
+
+func TestDB_Lookup_InvalidRegex(t *testing.T) {
+	d := testNewDB(t)
+	index, err := d.CreateIndex(getSingleFieldIndex("names"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testInsertNames(t, index, "brand")
+
+	it, err := index.Lookup(testNameLookup("brand-("), WithOperator("name", OperatorRegex))
+	assert.NoError(t, err)
+
+	_, err = it.Next(nil)
+	assert.ErrorIs(t, err, ErrInvalidOperator)
+}
+
+func testBidIndex(t *testing.T, db *DB) *Index {
+	index, err := db.CreateIndex(&api.IndexDefinition{
+		Name: "bids",
+		Fields: []*api.FieldDefinition{
+			{
+				Name:      "name",
+				DataType:  &api.FieldDefinition_Scalar{Scalar: api.ScalarType_DATA_TYPE_STRING},
+				IsPrimary: true,
+			},
+			scalarField("min_bid", api.ScalarType_DATA_TYPE_FLOAT),
+			scalarField("age", api.ScalarType_DATA_TYPE_INT),
+			scalarField("reach", api.ScalarType_DATA_TYPE_UINT),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bids := []struct {
+		name   string
+		minBid float64
+		age    int64
+		reach  uint64
+	}{
+		{name: "low", minBid: 1.5, age: -1, reach: 10},
+		{name: "mid", minBid: 2.5, age: 30, reach: 100},
+		{name: "high", minBid: 10, age: 65, reach: 1000},
+	}
+	for _, bid := range bids {
+		segment := getSingleFieldSegment(bid.name)
+		segment.Fields = append(segment.Fields,
+			&api.SegmentField{
+				Name:  "min_bid",
+				Value: &api.SegmentField_FloatValue{FloatValue: &api.SegmentFieldFloat{Value: bid.minBid}},
+			},
+			intSegmentField("age", bid.age),
+			&api.SegmentField{
+				Name:  "reach",
+				Value: &api.SegmentField_UintValue{UintValue: &api.SegmentFieldUInt{Value: bid.reach}},
+			},
+		)
+		if _, err = index.InsertSegment(segment); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return index
+}
+
+func TestDB_Lookup_Comparisons(t *testing.T) {
+	d := testNewDB(t)
+	index := testBidIndex(t, d)
+
+	floatField := func(value float64) *api.LookupField {
+		return &api.LookupField{
+			Name:  "min_bid",
+			Value: &api.LookupField_FloatValue{FloatValue: &api.SegmentFieldFloat{Value: value}},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		field    *api.LookupField
+		operator Operator
+		want     []string
+	}{
+		{name: "float >=", field: floatField(2.5), operator: OperatorGreaterOrEqual, want: []string{"mid", "high"}},
+		{name: "float >", field: floatField(2.5), operator: OperatorGreater, want: []string{"high"}},
+		{name: "float <", field: floatField(2.5), operator: OperatorLess, want: []string{"low"}},
+		{name: "float <=", field: floatField(2.5), operator: OperatorLessOrEqual, want: []string{"low", "mid"}},
+		{name: "float !=", field: floatField(2.5), operator: OperatorNotEqual, want: []string{"low", "high"}},
+		{
+			name: "float between a range",
+			field: &api.LookupField{
+				Name:  "min_bid",
+				Value: &api.LookupField_RangeFloatValue{RangeFloatValue: &api.SegmentFieldRangeFloat{Min: 1.5, Max: 2.5}},
+			},
+			operator: OperatorBetween,
+			want:     []string{"low", "mid"},
+		},
+		{
+			name: "int between a range",
+			field: &api.LookupField{
+				Name:  "age",
+				Value: &api.LookupField_RangeIntValue{RangeIntValue: &api.SegmentFieldRangeInt{Min: -5, Max: 30}},
+			},
+			operator: OperatorBetween,
+			want:     []string{"low", "mid"},
+		},
+		{
+			name: "uint between two values",
+			field: &api.LookupField{
+				Name: "reach",
+				Value: &api.LookupField_RepeatedUintValue{
+					RepeatedUintValue: &api.SegmentFieldRepeatedUInt{Value: []uint64{100, 5000}},
+				},
+			},
+			operator: OperatorBetween,
+			want:     []string{"mid", "high"},
+		},
+		{
+			name: "string <",
+			field: &api.LookupField{
+				Name:  "name",
+				Value: &api.LookupField_StringValue{StringValue: &api.SegmentFieldString{Value: "LOW"}},
+			},
+			operator: OperatorLess,
+			want:     []string{"high"},
+		},
+		{name: "nothing matches", field: floatField(10), operator: OperatorGreater, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it, err := index.Lookup(&api.Lookup{Fields: []*api.LookupField{tt.field}}, WithOperator(tt.field.Name, tt.operator))
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.ElementsMatchf(t, tt.want, testCollectKeys(t, it), "Lookup(%s %v)", tt.operator, tt.field)
+		})
+	}
+}
+
+func TestDB_Lookup_BetweenValueCount(t *testing.T) {
+	d := testNewDB(t)
+	index := testBidIndex(t, d)
+
+	it, err := index.Lookup(&api.Lookup{
+		Fields: []*api.LookupField{
+			{
+				Name:  "min_bid",
+				Value: &api.LookupField_FloatValue{FloatValue: &api.SegmentFieldFloat{Value: 2.5}},
+			},
+		},
+	}, WithOperator("min_bid", OperatorBetween))
+	assert.NoError(t, err)
+
+	_, err = it.Next(nil)
+	assert.ErrorIs(t, err, ErrInvalidOperator)
+}
+
+func TestDB_Lookup_BetweenInverted(t *testing.T) {
+	d := testNewDB(t)
+	index := testBidIndex(t, d)
+
+	minBid := &api.LookupField{
+		Name:  "min_bid",
+		Value: &api.LookupField_RangeFloatValue{RangeFloatValue: &api.SegmentFieldRangeFloat{Min: 2.5, Max: 1.5}},
+	}
+	age := &api.LookupField{
+		Name:  "age",
+		Value: &api.LookupField_RangeIntValue{RangeIntValue: &api.SegmentFieldRangeInt{Min: 30, Max: 30}},
+	}
+
+	tests := []struct {
+		name   string
+		fields []*api.LookupField
+	}{
+		{name: "scanned", fields: []*api.LookupField{minBid}},
+		{name: "tested alongside another field", fields: []*api.LookupField{age, minBid}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it, err := index.Lookup(&api.Lookup{Fields: tt.fields},
+				WithOperator("min_bid", OperatorBetween), WithOperator("age", OperatorBetween))
+			if assert.NoError(t, err) {
+				_, err = it.Next(nil)
+				assert.ErrorIs(t, err, ErrInvalidOperator)
+			}
+		})
+	}
+}
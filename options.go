@@ -0,0 +1,396 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	api "github.com/segmentq/protos-api-go"
+	"github.com/tidwall/buntdb"
+)
+
+// FieldType is a logical type the api data types do not describe, it is set on a field of the data type which
+// holds its values
+type FieldType string
+
+// FieldOptions extends a FieldDefinition with behaviour that is not described by the api protos
+type FieldOptions struct {
+	// Type is the logical type of the field, e.g. FieldTypeTimestamp on an INT64 field
+	Type FieldType `json:"type,omitempty"`
+
+	// Unique rejects inserts and replaces when another segment already holds the same value for the field
+	Unique bool `json:"unique,omitempty"`
+
+	// Coerce applies lossless conversions (e.g. int to float) when a value does not match the field type, values
+	// which would lose precision, such as ints above 2^53 in a float field, are out of range
+	Coerce bool `json:"coerce,omitempty"`
+
+	// Required rejects inserts and replaces of segments which do not set the field
+	Required bool `json:"required,omitempty"`
+
+	// Default is materialised into segments which do not set the field, before Required is checked
+	Default *api.SegmentField `json:"-"`
+
+	// NotIndexed fields are only persisted with the segment, they cost no index memory and cannot be looked up
+	NotIndexed bool `json:"not_indexed,omitempty"`
+
+	// MatchDescendants extends lookups on a path field to the segments on any path below the one looked up
+	MatchDescendants bool `json:"match_descendants,omitempty"`
+
+	// Collation is applied to the values of a string field before they are indexed or looked up, it cannot be set on
+	// primary or unique fields
+	Collation *Collation `json:"collation,omitempty"`
+
+	// MissingMatchesAny makes segments which omit the field match any lookup value for it, e.g. a segment without a
+	// country targets every country
+	MissingMatchesAny bool `json:"missing_matches_any,omitempty"`
+
+	// Excludes names the field whose lookups drop segments holding the looked up value in this field, e.g. a
+	// segment for every postcode except those in its excluded postcodes
+	Excludes string `json:"excludes,omitempty"`
+}
+
+// fieldOptionsJSON mirrors FieldOptions, storing the Default in the text format used for definitions
+type fieldOptionsJSON struct {
+	Type              FieldType  `json:"type,omitempty"`
+	Unique            bool       `json:"unique,omitempty"`
+	Coerce            bool       `json:"coerce,omitempty"`
+	Required          bool       `json:"required,omitempty"`
+	Default           string     `json:"default,omitempty"`
+	NotIndexed        bool       `json:"not_indexed,omitempty"`
+	MatchDescendants  bool       `json:"match_descendants,omitempty"`
+	Collation         *Collation `json:"collation,omitempty"`
+	MissingMatchesAny bool       `json:"missing_matches_any,omitempty"`
+	Excludes          string     `json:"excludes,omitempty"`
+}
+
+func (o *FieldOptions) MarshalJSON() ([]byte, error) {
+	encoded := fieldOptionsJSON{
+		Type:              o.Type,
+		Unique:            o.Unique,
+		Coerce:            o.Coerce,
+		Required:          o.Required,
+		NotIndexed:        o.NotIndexed,
+		MatchDescendants:  o.MatchDescendants,
+		Collation:         o.Collation,
+		MissingMatchesAny: o.MissingMatchesAny,
+		Excludes:          o.Excludes,
+	}
+
+	if o.Default != nil {
+		encoded.Default = proto.MarshalTextString(o.Default)
+	}
+
+	return json.Marshal(encoded)
+}
+
+func (o *FieldOptions) UnmarshalJSON(data []byte) error {
+	var decoded fieldOptionsJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	*o = FieldOptions{
+		Type:              decoded.Type,
+		Unique:            decoded.Unique,
+		Coerce:            decoded.Coerce,
+		Required:          decoded.Required,
+		NotIndexed:        decoded.NotIndexed,
+		MatchDescendants:  decoded.MatchDescendants,
+		Collation:         decoded.Collation,
+		MissingMatchesAny: decoded.MissingMatchesAny,
+		Excludes:          decoded.Excludes,
+	}
+
+	if decoded.Default != "" {
+		o.Default = &api.SegmentField{}
+		if err := proto.UnmarshalText(decoded.Default, o.Default); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (o *FieldOptions) fieldType() FieldType {
+	if o == nil {
+		return ""
+	}
+	return o.Type
+}
+
+func (o *FieldOptions) coerce() bool {
+	return o != nil && o.Coerce
+}
+
+func (o *FieldOptions) indexed() bool {
+	return o == nil || !o.NotIndexed
+}
+
+func (o *FieldOptions) matchDescendants() bool {
+	return o != nil && o.MatchDescendants
+}
+
+func (o *FieldOptions) missingMatchesAny() bool {
+	return o != nil && o.MissingMatchesAny
+}
+
+func (o *FieldOptions) collation() *Collation {
+	if o == nil {
+		return nil
+	}
+	return o.Collation
+}
+
+// CreateIndexWithOptions takes an IndexDefinition and the FieldOptions by field name and returns an Index
+func (db *DB) CreateIndexWithOptions(indexDefinition *api.IndexDefinition, options map[string]*FieldOptions) (*Index, error) {
+	index := newIndex(db, indexDefinition)
+	if err := index.create(options); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// FieldOptions returns the options for the named field, an empty FieldOptions is returned when none were set
+func (i *Index) FieldOptions(name string) (*FieldOptions, error) {
+	if _, ok := i.db.fields[i.definition.Name][name]; !ok {
+		return nil, ErrFieldUnknown
+	}
+
+	if options, ok := i.db.options[i.definition.Name][name]; ok {
+		return options, nil
+	}
+
+	return &FieldOptions{}, nil
+}
+
+// prepareOptions ensures options are only set on fields that are part of the definition and defaults match the
+// field type, a copy of the options is returned so later changes by the caller have no effect
+func prepareOptions(definition *api.IndexDefinition, options map[string]*FieldOptions) (map[string]*FieldOptions, error) {
+	prepared := make(map[string]*FieldOptions, len(options))
+
+	for name, fieldOptions := range options {
+		var fieldDefinition *api.FieldDefinition
+		for _, field := range definition.Fields {
+			if field.Name == name {
+				fieldDefinition = field
+				break
+			}
+		}
+
+		if fieldDefinition == nil {
+			return nil, ErrFieldUnknown
+		}
+
+		if fieldOptions == nil {
+			continue
+		}
+
+		if err := checkFieldType(fieldDefinition, fieldOptions.Type); err != nil {
+			return nil, err
+		}
+
+		// Primary and unique values are resolved through the field index
+		if fieldOptions.NotIndexed && (fieldDefinition.IsPrimary || fieldOptions.Unique) {
+			return nil, fmt.Errorf("%w: %s is primary or unique so must be indexed", ErrInvalidFieldOptions, name)
+		}
+
+		if fieldOptions.MatchDescendants && !isPathScalar(fieldDefinition, fieldOptions.Type) {
+			return nil, fmt.Errorf("%w: %s is not a path so has no descendants", ErrInvalidFieldOptions, name)
+		}
+
+		// A field can only be missing when nothing fills it in, and must be indexed for the marker to be found
+		if fieldOptions.MissingMatchesAny && (fieldDefinition.IsPrimary || fieldOptions.Required ||
+			fieldOptions.Default != nil || fieldOptions.NotIndexed) {
+			return nil, fmt.Errorf("%w: %s is always set or not indexed so cannot match when missing",
+				ErrInvalidFieldOptions, name)
+		}
+
+		if fieldOptions.Excludes != "" {
+			if err := checkExcludes(definition, fieldDefinition, fieldOptions, options); err != nil {
+				return nil, err
+			}
+		}
+
+		if !fieldOptions.Collation.isZero() && (!isStringScalar(fieldDefinition) || fieldOptions.Type != "") {
+			return nil, fmt.Errorf("%w: %s is not a string so cannot be collated", ErrInvalidFieldOptions, name)
+		}
+
+		// Collated keys would fold distinct values together and silently overwrite or clash
+		if !fieldOptions.Collation.isZero() && (fieldDefinition.IsPrimary || fieldOptions.Unique) {
+			return nil, fmt.Errorf("%w: %s is primary or unique so cannot be collated", ErrInvalidFieldOptions, name)
+		}
+
+		copied := *fieldOptions
+		if copied.Collation != nil {
+			collation := *copied.Collation
+			copied.Collation = &collation
+		}
+		if copied.Default != nil {
+			copied.Default = proto.Clone(copied.Default).(*api.SegmentField)
+			copied.Default.Name = name
+
+			checked, err := checkSegmentField(fieldDefinition, copied.Default, &copied)
+			if err != nil {
+				return nil, err
+			}
+			copied.Default = checked
+		}
+
+		prepared[name] = &copied
+	}
+
+	return prepared, nil
+}
+
+// checkFieldType ensures a logical type is set on a field of the data type which holds its values
+func checkFieldType(definition *api.FieldDefinition, fieldType FieldType) error {
+	_, scalar := definition.GetDataType().(*api.FieldDefinition_Scalar)
+	_, geo := definition.GetDataType().(*api.FieldDefinition_Geo)
+
+	switch fieldType {
+	case "":
+		return nil
+	case FieldTypeTimestamp:
+		if scalar && isInt64Scalar(definition) || geo && definition.GetGeo() == api.GeoType_DATA_TYPE_RANGE_INT {
+			return nil
+		}
+	case FieldTypeDate:
+		if scalar && isInt64Scalar(definition) {
+			return nil
+		}
+	case FieldTypeIP, FieldTypePath:
+		if scalar && definition.GetScalar() == api.ScalarType_DATA_TYPE_STRING {
+			return nil
+		}
+	case FieldTypeCIDR:
+		if geo && definition.GetGeo() == api.GeoType_DATA_TYPE_RANGE {
+			return nil
+		}
+	default:
+		return fmt.Errorf("%w: %s has the unknown type %q", ErrInvalidFieldOptions, definition.Name, fieldType)
+	}
+
+	return fmt.Errorf("%w: %s of %s cannot be a %s", ErrInvalidFieldOptions, definition.Name,
+		fieldTypeName(definition, ""), fieldType)
+}
+
+// isInt64Scalar reports whether a scalar field holds values of 64 bits
+func isInt64Scalar(definition *api.FieldDefinition) bool {
+	scalar := definition.GetScalar()
+	return scalar == api.ScalarType_DATA_TYPE_INT || scalar == api.ScalarType_DATA_TYPE_INT64
+}
+
+// checkExcludes ensures an exclusion field is indexed and holds the same type as the one field it excludes
+func checkExcludes(definition *api.IndexDefinition, fieldDefinition *api.FieldDefinition, fieldOptions *FieldOptions,
+	options map[string]*FieldOptions) error {
+	name := fieldDefinition.Name
+	if fieldOptions.Excludes == name || fieldDefinition.IsPrimary || fieldOptions.NotIndexed {
+		return fmt.Errorf("%w: %s cannot exclude %s", ErrInvalidFieldOptions, name, fieldOptions.Excludes)
+	}
+
+	var excluded *api.FieldDefinition
+	for _, field := range definition.Fields {
+		if field.Name == fieldOptions.Excludes {
+			excluded = field
+			break
+		}
+	}
+	if excluded == nil {
+		return fmt.Errorf("%w: %s excludes %s", ErrFieldUnknown, name, fieldOptions.Excludes)
+	}
+
+	fieldType, excludedType := fieldOptions.Type, options[excluded.Name].fieldType()
+	if fieldTypeName(excluded, excludedType) != fieldTypeName(fieldDefinition, fieldType) {
+		return fmt.Errorf("%w: %s of %s cannot exclude %s of %s", ErrInvalidFieldOptions, name,
+			fieldTypeName(fieldDefinition, fieldType), excluded.Name, fieldTypeName(excluded, excludedType))
+	}
+
+	for other, otherOptions := range options {
+		if other != name && otherOptions != nil && otherOptions.Excludes == fieldOptions.Excludes {
+			return fmt.Errorf("%w: %s is already excluded by %s", ErrInvalidFieldOptions, excluded.Name, other)
+		}
+	}
+
+	return nil
+}
+
+// excludedBy returns the name of the field holding the excluded values of a field, or "" when there is none
+func (db *DB) excludedBy(indexName string, field string) string {
+	for name, options := range db.options[indexName] {
+		if options.Excludes == field {
+			return name
+		}
+	}
+	return ""
+}
+
+// indexedFields returns the fields of the index which have an engine index
+func (i *Index) indexedFields() []*api.FieldDefinition {
+	fields := make([]*api.FieldDefinition, 0, len(i.definition.Fields))
+	for _, field := range i.definition.Fields {
+		if i.db.options[i.definition.Name][field.Name].indexed() {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// storeOptions persists the field options for cold starts, nothing is stored when there are no options
+func (i *Index) storeOptions(tx *buntdb.Tx, options map[string]*FieldOptions) error {
+	if len(options) == 0 {
+		return nil
+	}
+
+	encoded, err := json.Marshal(options)
+	if err != nil {
+		return ErrMarshallingFailed
+	}
+
+	_, _, err = tx.Set(idxKey(fieldOptsByIdx, i.definition.Name), string(encoded), nil)
+	if err != nil {
+		return ErrInternalDBError
+	}
+
+	return nil
+}
+
+// deleteOptions removes any persisted field options for the index
+func (i *Index) deleteOptions(tx *buntdb.Tx) error {
+	_, err := tx.Delete(idxKey(fieldOptsByIdx, i.definition.Name))
+	if err != nil && err != buntdb.ErrNotFound {
+		return ErrInternalDBError
+	}
+
+	return nil
+}
+
+// readOptions loads persisted field options for an index, usually when starting the engine
+func (db *DB) readOptions(tx *buntdb.Tx, indexName string) (map[string]*FieldOptions, error) {
+	encoded, err := tx.Get(idxKey(fieldOptsByIdx, indexName), true)
+	if err == buntdb.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, ErrInternalDBError
+	}
+
+	options := make(map[string]*FieldOptions, 0)
+	if err = json.Unmarshal([]byte(encoded), &options); err != nil {
+		return nil, ErrMarshallingFailed
+	}
+
+	return options, nil
+}
+
+// loadIndexOptions is used to keep field options in memory alongside the field definitions
+func (db *DB) loadIndexOptions(indexName string, options map[string]*FieldOptions) {
+	if len(options) == 0 {
+		return
+	}
+
+	if db.options == nil {
+		db.options = make(map[string]map[string]*FieldOptions, 0)
+	}
+
+	db.options[indexName] = options
+}
@@ -0,0 +1,326 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	api "github.com/segmentq/protos-api-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func getAudienceIndex(name string) *api.IndexDefinition {
+	return &api.IndexDefinition{
+		Name: name,
+		Fields: []*api.FieldDefinition{
+			{
+				Name:      "name",
+				DataType:  &api.FieldDefinition_Scalar{Scalar: api.ScalarType_DATA_TYPE_STRING},
+				IsPrimary: true,
+			},
+			{
+				Name:     "external_id",
+				DataType: &api.FieldDefinition_Scalar{Scalar: api.ScalarType_DATA_TYPE_STRING},
+			},
+		},
+	}
+}
+
+func getAudienceSegment(name, externalId string) *api.Segment {
+	return &api.Segment{
+		Fields: []*api.SegmentField{
+			{
+				Name: "name",
+				Value: &api.SegmentField_StringValue{
+					StringValue: &api.SegmentFieldString{Value: name},
+				},
+			},
+			{
+				Name: "external_id",
+				Value: &api.SegmentField_StringValue{
+					StringValue: &api.SegmentFieldString{Value: externalId},
+				},
+			},
+		},
+	}
+}
+
+func TestDB_CreateIndexWithOptions(t *testing.T) {
+	type args struct {
+		indexDefinition *api.IndexDefinition
+		options         map[string]*FieldOptions
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{
+			name: "golden path",
+			args: args{
+				indexDefinition: getAudienceIndex("audience"),
+				options:         map[string]*FieldOptions{"external_id": {Unique: true}},
+			},
+			wantErr: assert.NoError,
+		},
+		{
+			name: "no options",
+			args: args{
+				indexDefinition: getAudienceIndex("audience"),
+			},
+			wantErr: assert.NoError,
+		},
+		{
+			name: "options for unknown field",
+			args: args{
+				indexDefinition: getAudienceIndex("audience"),
+				options:         map[string]*FieldOptions{"banana": {Unique: true}},
+			},
+			wantErr: assert.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := testNewDB(t)
+			got, err := d.CreateIndexWithOptions(tt.args.indexDefinition, tt.args.options)
+			if !tt.wantErr(t, err, fmt.Sprintf("CreateIndexWithOptions(%v, %v)", tt.args.indexDefinition, tt.args.options)) || err != nil {
+				return
+			}
+
+			for name, want := range tt.args.options {
+				options, err := got.FieldOptions(name)
+				assert.NoError(t, err)
+				assert.Equal(t, want, options)
+			}
+		})
+	}
+}
+
+func TestIndex_FieldOptions(t *testing.T) {
+	d := testNewDB(t)
+	index, err := d.CreateIndexWithOptions(getAudienceIndex("audience"), map[string]*FieldOptions{
+		"external_id": {Unique: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		fieldName string
+		want      *FieldOptions
+		wantErr   assert.ErrorAssertionFunc
+	}{
+		{
+			name:      "field with options",
+			fieldName: "external_id",
+			want:      &FieldOptions{Unique: true},
+			wantErr:   assert.NoError,
+		},
+		{
+			name:      "field without options",
+			fieldName: "name",
+			want:      &FieldOptions{},
+			wantErr:   assert.NoError,
+		},
+		{
+			name:      "unknown field",
+			fieldName: "banana",
+			wantErr:   assert.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := index.FieldOptions(tt.fieldName)
+			if !tt.wantErr(t, err, fmt.Sprintf("FieldOptions(%v)", tt.fieldName)) {
+				return
+			}
+			assert.Equalf(t, tt.want, got, "FieldOptions(%v)", tt.fieldName)
+		})
+	}
+}
+
+func TestIndex_InsertSegment_Unique(t *testing.T) {
+	d := testNewDB(t)
+	index, err := d.CreateIndexWithOptions(getAudienceIndex("audience"), map[string]*FieldOptions{
+		"external_id": {Unique: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = index.InsertSegment(getAudienceSegment("sports", "dmp-1"))
+	assert.NoError(t, err)
+
+	// Re-inserting the same segment is not a conflict
+	_, err = index.InsertSegment(getAudienceSegment("sports", "dmp-1"))
+	assert.NoError(t, err)
+
+	// Another segment with the same external id conflicts and names the holder
+	_, err = index.InsertSegment(getAudienceSegment("news", "dmp-1"))
+	assert.True(t, errors.Is(err, ErrUniqueConflict))
+	assert.Contains(t, err.Error(), "sports")
+
+	// The conflicting segment must not have been written
+	_, err = index.GetSegmentByKey("news")
+	assert.ErrorIs(t, err, ErrSegmentNotFound)
+
+	_, err = index.InsertSegment(getAudienceSegment("news", "dmp-2"))
+	assert.NoError(t, err)
+
+	// Replacing a segment with a value held elsewhere conflicts
+	_, err = index.ReplaceSegment("news", getAudienceSegment("news", "dmp-1"))
+	assert.ErrorIs(t, err, ErrUniqueConflict)
+
+	// Replacing a segment frees its old value within the same transaction
+	_, err = index.ReplaceSegment("sports", getAudienceSegment("sports", "dmp-3"))
+	assert.NoError(t, err)
+
+	_, err = index.ReplaceSegment("news", getAudienceSegment("news", "dmp-1"))
+	assert.NoError(t, err)
+}
+
+func TestFieldOptions_MarshalJSON(t *testing.T) {
+	options := &FieldOptions{
+		Unique:   true,
+		Required: true,
+		Default: &api.SegmentField{
+			Name:  "country",
+			Value: &api.SegmentField_StringValue{StringValue: &api.SegmentFieldString{Value: "GB"}},
+		},
+	}
+
+	encoded, err := json.Marshal(options)
+	assert.NoError(t, err)
+
+	decoded := &FieldOptions{}
+	assert.NoError(t, json.Unmarshal(encoded, decoded))
+
+	assert.Equal(t, options.Unique, decoded.Unique)
+	assert.Equal(t, options.Required, decoded.Required)
+	assert.True(t, proto.Equal(options.Default, decoded.Default))
+}
+
+func TestIndex_InsertSegment_RequiredAndDefault(t *testing.T) {
+	d := testNewDB(t)
+	definition := getAudienceIndex("audience")
+	definition.Fields = append(definition.Fields, &api.FieldDefinition{
+		Name:     "country",
+		DataType: &api.FieldDefinition_Scalar{Scalar: api.ScalarType_DATA_TYPE_STRING},
+	})
+
+	index, err := d.CreateIndexWithOptions(definition, map[string]*FieldOptions{
+		"external_id": {Required: true},
+		"country": {
+			Default: &api.SegmentField{
+				Value: &api.SegmentField_StringValue{StringValue: &api.SegmentFieldString{Value: "GB"}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Missing a required field
+	_, err = index.InsertSegment(getSingleFieldSegment("sports"))
+	assert.ErrorIs(t, err, ErrRequiredMissing)
+	assert.Contains(t, err.Error(), "external_id")
+
+	// The default is materialised into the stored segment without changing the callers proto
+	segment := getAudienceSegment("sports", "dmp-1")
+	_, err = index.InsertSegment(segment)
+	assert.NoError(t, err)
+	assert.Len(t, segment.Fields, 2)
+
+	stored, err := index.GetSegmentByKey("sports")
+	assert.NoError(t, err)
+	assert.Len(t, stored.Proto().Fields, 3)
+
+	// The default is also materialised into the field index
+	it, err := index.Lookup(&api.Lookup{
+		Fields: []*api.LookupField{
+			{
+				Name:  "country",
+				Value: &api.LookupField_StringValue{StringValue: &api.SegmentFieldString{Value: "GB"}},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	key, err := it.Next(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "sports", key)
+
+	// Replacing also enforces required fields
+	_, err = index.ReplaceSegment("sports", getSingleFieldSegment("sports"))
+	assert.ErrorIs(t, err, ErrRequiredMissing)
+}
+
+func TestDB_CreateIndexWithOptions_DefaultTypeMismatch(t *testing.T) {
+	d := testNewDB(t)
+	_, err := d.CreateIndexWithOptions(getAudienceIndex("audience"), map[string]*FieldOptions{
+		"external_id": {
+			Default: &api.SegmentField{
+				Value: &api.SegmentField_IntValue{IntValue: &api.SegmentFieldInt{Value: 1}},
+			},
+		},
+	})
+	assert.ErrorIs(t, err, ErrTypeMismatch)
+}
+
+func TestIndex_InsertSegment_NotIndexed(t *testing.T) {
+	d := testNewDB(t)
+	index, err := d.CreateIndexWithOptions(getAudienceIndex("audience"), map[string]*FieldOptions{
+		"external_id": {NotIndexed: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// No engine index is created for the field
+	indexes, err := d.engine.Indexes()
+	assert.NoError(t, err)
+	for _, name := range indexes {
+		assert.NotContains(t, name, "external_id")
+	}
+
+	_, err = index.InsertSegment(getAudienceSegment("sports", "dmp-1"))
+	assert.NoError(t, err)
+
+	// The value is still returned with the segment
+	stored, err := index.GetSegmentByKey("sports")
+	assert.NoError(t, err)
+	assert.Len(t, stored.Proto().Fields, 2)
+
+	// But it cannot be looked up
+	it, err := index.Lookup(&api.Lookup{
+		Fields: []*api.LookupField{
+			{
+				Name:  "external_id",
+				Value: &api.LookupField_StringValue{StringValue: &api.SegmentFieldString{Value: "dmp-1"}},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	_, err = it.Next(nil)
+	assert.ErrorIs(t, err, ErrFieldNotIndexed)
+
+	// Replacing, deleting and dropping the index skip the missing field index
+	_, err = index.ReplaceSegment("sports", getAudienceSegment("sports", "dmp-2"))
+	assert.NoError(t, err)
+
+	_, err = index.DeleteSegment("sports")
+	assert.NoError(t, err)
+
+	assert.NoError(t, index.Delete())
+}
+
+func TestDB_CreateIndexWithOptions_NotIndexedPrimary(t *testing.T) {
+	d := testNewDB(t)
+	_, err := d.CreateIndexWithOptions(getAudienceIndex("audience"), map[string]*FieldOptions{
+		"name": {NotIndexed: true},
+	})
+	assert.ErrorIs(t, err, ErrInvalidFieldOptions)
+}
@@ -0,0 +1,270 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	api "github.com/segmentq/protos-api-go"
+	"github.com/tidwall/buntdb"
+	"sort"
+	"strings"
+)
+
+// page limits results to those after the position held by a cursor and the offset which follows it, in the order of
+// the lookup or listing
+type page struct {
+	limit  int
+	offset int
+	after  *entry
+	scope  string
+	order  *order
+}
+
+// cursor is the decoded form of the opaque cursors returned with each page
+type cursor struct {
+	// Key is the last key of the page the cursor was returned with
+	Key string `json:"key"`
+
+	// Value and Missing hold the sort value of the last key, when results are sorted by a field
+	Value   string `json:"value,omitempty"`
+	Missing bool   `json:"missing,omitempty"`
+
+	// Scope is the fingerprint of the lookup or listing the cursor belongs to
+	Scope string `json:"scope"`
+}
+
+// newPage decodes a cursor, which must have been returned by a page of the same scope
+func newPage(limit int, encoded string, scope string, o *order) (*page, error) {
+	p := &page{limit: limit, scope: scope, order: o}
+	if encoded == "" {
+		return p, nil
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCursor, err)
+	}
+
+	var c cursor
+	if err = json.Unmarshal(decoded, &c); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCursor, err)
+	}
+
+	if c.Scope != scope {
+		return nil, fmt.Errorf("%w: cursor belongs to another lookup or listing", ErrInvalidCursor)
+	}
+
+	p.after = &entry{key: c.Key, value: c.Value, missing: c.Missing}
+	return p, nil
+}
+
+// cursor encodes the cursor of the page which follows the entry
+func (p *page) cursor(e entry) string {
+	encoded, _ := json.Marshal(&cursor{Key: e.key, Value: e.value, Missing: e.missing, Scope: p.scope})
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// includes reports whether an entry is after the cursor of the page
+func (p *page) includes(e entry) bool {
+	return p.after == nil || p.order.before(*p.after, e)
+}
+
+// full reports whether a page holding the number of results is full, a limit of 0 or less is no limit
+func (p *page) full(results int) bool {
+	return p.limit > 0 && results >= p.limit
+}
+
+// pageEntries keeps the first entries of a page in order while candidates are found in any order, so no more than
+// the limit and one more, which tells whether another page follows, are held at a time
+type pageEntries struct {
+	p       *page
+	entries []entry
+}
+
+func (k *pageEntries) add(e entry) {
+	if !k.p.includes(e) {
+		return
+	}
+
+	n := sort.Search(len(k.entries), func(n int) bool {
+		return !k.p.order.before(k.entries[n], e)
+	})
+	if n < len(k.entries) && k.entries[n].key == e.key {
+		return
+	}
+	if k.p.limit > 0 && n > k.p.limit {
+		return
+	}
+
+	k.entries = append(k.entries, entry{})
+	copy(k.entries[n+1:], k.entries[n:])
+	k.entries[n] = e
+
+	if k.p.limit > 0 && len(k.entries) > k.p.limit+1 {
+		k.entries = k.entries[:k.p.limit+1]
+	}
+}
+
+// page returns the entries of the page and the cursor of the next, which is empty on the last page
+func (k *pageEntries) page() ([]entry, string) {
+	if k.p.full(len(k.entries)) && len(k.entries) > k.p.limit {
+		entries := k.entries[:k.p.limit]
+		return entries, k.p.cursor(entries[len(entries)-1])
+	}
+	return k.entries, ""
+}
+
+// fingerprint identifies a lookup or listing, so a cursor is not used to resume a different one
+func fingerprint(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// fingerprint identifies the index, fields, operators and query of the lookup
+func (l *Lookup) fingerprint(indexName string) string {
+	parts := []string{"lookup", indexName, proto.CompactTextString(l.lookup)}
+
+	names := make([]string, 0, len(l.operators))
+	for name := range l.operators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s %s", name, l.operators[name]))
+	}
+
+	if l.query != nil {
+		parts = append(parts, l.query.String())
+	}
+
+	if l.sorted {
+		parts = append(parts, fmt.Sprintf("sort %s %t", l.sortField, l.descending))
+	}
+
+	if l.scoring != nil {
+		parts = append(parts, "scoring "+l.scoring.String())
+	}
+
+	return fingerprint(parts...)
+}
+
+// GetSegmentsPage visits the segments of the index in the order of their keys, up to the limit and from the cursor
+// returned with the previous page, skipping offset segments first. The cursor of the next page is returned, or an
+// empty one on the last page.
+func (db *DB) GetSegmentsPage(indexName string, limit int, offset int, cursor string,
+	iter func(segment *api.Segment) bool) (string, error) {
+	i, err := db.GetIndexByName(indexName)
+	if err != nil {
+		return "", err
+	}
+
+	return i.GetSegmentsPage(limit, offset, cursor, iter)
+}
+
+// GetSegmentsPage visits the segments of the index in the order of their keys, up to the limit and from the cursor
+// returned with the previous page, skipping offset segments first. The cursor of the next page is returned, or an
+// empty one on the last page.
+func (i *Index) GetSegmentsPage(limit int, offset int, cursor string,
+	iter func(segment *api.Segment) bool) (string, error) {
+	p, err := newPage(limit, cursor, fingerprint("segments", i.definition.Name), keyOrder)
+	if err != nil {
+		return "", err
+	}
+
+	next := ""
+	err = i.db.engine.View(func(tx *buntdb.Tx) error {
+		idx, err := tx.Get(idxKey(idxById, i.definition.Name), true)
+		if err != nil {
+			return ErrInternalDBError
+		}
+
+		// Segments are visited by key rather than through the segment index, which orders them by their text
+		prefix := idxKey(segmentByPrimaryKey, idx) + idxSep
+		pivot := prefix
+		if p.after != nil {
+			pivot = prefix + p.after.key + "\x00"
+		}
+
+		visited, skipped, last := 0, 0, ""
+		var visitErr error
+		err = tx.AscendGreaterOrEqual("", pivot, func(key, value string) bool {
+			if !strings.HasPrefix(key, prefix) {
+				return false
+			}
+
+			if skipped < offset {
+				skipped, last = skipped+1, strings.TrimPrefix(key, prefix)
+				return true
+			}
+
+			if p.full(visited) {
+				next = p.cursor(entry{key: last})
+				return false
+			}
+
+			var s api.Segment
+			if err := proto.UnmarshalText(value, &s); err != nil {
+				visitErr = ErrMarshallingFailed
+				return false
+			}
+
+			// A page stopped by the caller resumes after the last segment it visited
+			visited, last = visited+1, strings.TrimPrefix(key, prefix)
+			if !iter(&s) {
+				next = p.cursor(entry{key: last})
+				return false
+			}
+			return true
+		})
+		if err != nil {
+			return ErrInternalDBError
+		}
+
+		return visitErr
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return next, nil
+}
+
+// ListIndexesPage returns the indexes in the order of their names, up to the limit and from the cursor returned with
+// the previous page, skipping offset indexes first. The cursor of the next page is returned, or an empty one on the
+// last page.
+func (db *DB) ListIndexesPage(limit int, offset int, cursor string) ([]*api.IndexDefinition, string, error) {
+	p, err := newPage(limit, cursor, fingerprint("indexes"), keyOrder)
+	if err != nil {
+		return nil, "", err
+	}
+
+	names := make([]string, 0, len(db.idx))
+	for name := range db.idx {
+		if p.includes(entry{key: name}) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	if offset > len(names) {
+		offset = len(names)
+	}
+	names = names[offset:]
+
+	next := ""
+	if p.full(len(names)) && len(names) > p.limit {
+		names = names[:p.limit]
+		next = p.cursor(entry{key: names[len(names)-1]})
+	}
+
+	list := make([]*api.IndexDefinition, 0, len(names))
+	for _, name := range names {
+		list = append(list, db.idx[name])
+	}
+
+	return list, next, nil
+}
@@ -0,0 +1,231 @@
+package db
+
+import (
+	"fmt"
+	api "github.com/segmentq/protos-api-go"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"testing"
+)
+
+func TestIndex_Lookup_WithPage(t *testing.T) {
+	d := testNewDB(t)
+	index := testActiveIndex(t, d, 30)
+	lookup := &api.Lookup{Fields: []*api.LookupField{boolLookupField("active", true)}}
+
+	tests := []struct {
+		name  string
+		limit int
+		pages int
+	}{
+		{name: "pages of 7", limit: 7, pages: 4},
+		{name: "page of every result", limit: 27, pages: 1},
+		{name: "no limit", limit: 0, pages: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := make([]string, 0)
+			cursor := ""
+			pages := 0
+
+			for {
+				it, err := index.Lookup(lookup, WithPage(tt.limit, cursor))
+				if !assert.NoError(t, err) {
+					return
+				}
+
+				page := testCollectKeys(t, it)
+				if tt.limit > 0 {
+					assert.LessOrEqual(t, len(page), tt.limit)
+				}
+				assert.True(t, sort.StringsAreSorted(page))
+
+				keys = append(keys, page...)
+				pages++
+
+				if cursor = it.Cursor(); cursor == "" {
+					break
+				}
+			}
+
+			assert.Equal(t, tt.pages, pages)
+			assert.Len(t, keys, 27)
+			assert.True(t, sort.StringsAreSorted(keys))
+		})
+	}
+}
+
+func TestIndex_Lookup_WithPage_Cursor(t *testing.T) {
+	d := testNewDB(t)
+	index := testActiveIndex(t, d, 30)
+	lookup := &api.Lookup{Fields: []*api.LookupField{boolLookupField("active", true)}}
+
+	it, err := index.Lookup(lookup, WithPage(5, ""))
+	if !assert.NoError(t, err) {
+		return
+	}
+	testCollectKeys(t, it)
+	cursor := it.Cursor()
+	assert.NotEmpty(t, cursor)
+
+	_, err = index.Lookup(lookup, WithPage(5, "not a cursor"))
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	// A cursor cannot resume a different lookup
+	other := &api.Lookup{Fields: []*api.LookupField{boolLookupField("active", false)}}
+	_, err = index.Lookup(other, WithPage(5, cursor))
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	_, err = index.Lookup(lookup, WithPage(5, cursor), WithOperator("active", OperatorNotEqual))
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestIndex_Lookup_WithOffset(t *testing.T) {
+	d := testNewDB(t)
+	index := testActiveIndex(t, d, 100)
+	lookup := &api.Lookup{Fields: []*api.LookupField{boolLookupField("active", true)}}
+
+	it, err := index.Lookup(lookup, WithSort("name", false))
+	if !assert.NoError(t, err) {
+		return
+	}
+	keys := testCollectKeys(t, it)
+	if !assert.Len(t, keys, 90) {
+		return
+	}
+
+	tests := []struct {
+		name    string
+		offset  int
+		options []LookupOption
+		want    []string
+	}{
+		{name: "unordered", offset: 70, want: keys[70:]},
+		{name: "sorted", offset: 5, options: []LookupOption{WithSort("name", false)}, want: keys[5:]},
+		{name: "page", offset: 3, options: []LookupOption{WithPage(7, "")}, want: keys[3:10]},
+		{name: "page past a batch", offset: 60, options: []LookupOption{WithPage(20, "")}, want: keys[60:80]},
+		{name: "past the results", offset: 90, options: []LookupOption{WithPage(7, "")}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it, err := index.Lookup(lookup, append(tt.options, WithOffset(tt.offset))...)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			assert.Equal(t, tt.want, testCollectKeys(t, it))
+		})
+	}
+
+	// The cursor of a page after an offset resumes after the last result of the page
+	it, err = index.Lookup(lookup, WithPage(5, ""), WithOffset(10))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, keys[10:15], testCollectKeys(t, it))
+
+	it, err = index.Lookup(lookup, WithPage(5, it.Cursor()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, keys[15:20], testCollectKeys(t, it))
+}
+
+func TestIndex_GetSegmentsPage(t *testing.T) {
+	d := testNewDB(t)
+	index := testActiveIndex(t, d, 30)
+
+	keys := make([]string, 0)
+	cursor := ""
+	for pages := 1; ; pages++ {
+		next, err := index.GetSegmentsPage(8, 0, cursor, func(segment *api.Segment) bool {
+			keys = append(keys, segment.GetFields()[0].GetStringValue().GetValue())
+			return true
+		})
+		if !assert.NoError(t, err) || !assert.LessOrEqual(t, pages, 4) {
+			return
+		}
+
+		if cursor = next; cursor == "" {
+			break
+		}
+	}
+
+	assert.Len(t, keys, 30)
+	assert.True(t, sort.StringsAreSorted(keys))
+
+	// A page stopped early resumes after the last segment visited
+	first := ""
+	cursor, err := index.GetSegmentsPage(0, 0, "", func(segment *api.Segment) bool {
+		first = segment.GetFields()[0].GetStringValue().GetValue()
+		return false
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, keys[0], first)
+
+	_, err = index.GetSegmentsPage(1, 0, cursor, func(segment *api.Segment) bool {
+		assert.Equal(t, keys[1], segment.GetFields()[0].GetStringValue().GetValue())
+		return true
+	})
+	assert.NoError(t, err)
+
+	// An offset skips segments without visiting them and the cursor resumes after the page
+	offset := make([]string, 0)
+	cursor, err = index.GetSegmentsPage(4, 10, "", func(segment *api.Segment) bool {
+		offset = append(offset, segment.GetFields()[0].GetStringValue().GetValue())
+		return true
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, keys[10:14], offset)
+
+	_, err = index.GetSegmentsPage(1, 0, cursor, func(segment *api.Segment) bool {
+		assert.Equal(t, keys[14], segment.GetFields()[0].GetStringValue().GetValue())
+		return true
+	})
+	assert.NoError(t, err)
+
+	_, err = d.GetSegmentsPage("unknown", 1, 0, "", func(*api.Segment) bool { return true })
+	assert.ErrorIs(t, err, ErrIndexUnknown)
+}
+
+func TestDB_ListIndexesPage(t *testing.T) {
+	d := testNewDB(t)
+	for n := 0; n < 5; n++ {
+		testSingleFieldIndex(t, d, fmt.Sprintf("index-%d", n))
+	}
+
+	names := make([]string, 0)
+	cursor := ""
+	for {
+		list, next, err := d.ListIndexesPage(2, 0, cursor)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.LessOrEqual(t, len(list), 2)
+
+		for _, definition := range list {
+			names = append(names, definition.Name)
+		}
+
+		if cursor = next; cursor == "" {
+			break
+		}
+	}
+
+	assert.Equal(t, []string{"index-0", "index-1", "index-2", "index-3", "index-4"}, names)
+
+	list, next, err := d.ListIndexesPage(2, 2, "")
+	if assert.NoError(t, err) && assert.Len(t, list, 2) {
+		assert.Equal(t, "index-2", list[0].Name)
+		assert.Equal(t, "index-3", list[1].Name)
+		assert.NotEmpty(t, next)
+	}
+
+	list, next, err = d.ListIndexesPage(2, 10, "")
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+	assert.Empty(t, next)
+
+	_, _, err = d.ListIndexesPage(2, 0, "bm90IGEgY3Vyc29y")
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"fmt"
+	api "github.com/segmentq/protos-api-go"
+	"strconv"
+	"strings"
+)
+
+// FieldTypePath is set in the FieldOptions of STRING fields which take taxonomy paths as a StringValue, e.g.
+// "sports/football/premier-league", a lookup finds
+// the segments on the path or any of its ancestors
+const FieldTypePath FieldType = "path"
+
+const pathSeparator = "/"
+
+// isPathScalar reports whether the field holds taxonomy paths
+func isPathScalar(definition *api.FieldDefinition, fieldType FieldType) bool {
+	_, ok := definition.GetDataType().(*api.FieldDefinition_Scalar)
+	return ok && fieldType == FieldTypePath
+}
+
+// pathKey encodes a path with a trailing separator, so "sports/" is a prefix of "sports/football/" but not of
+// "sportswear/"
+func pathKey(definition *api.FieldDefinition, value string) (string, error) {
+	parts := make([]string, 0)
+	for _, part := range strings.Split(value, pathSeparator) {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	if len(parts) == 0 {
+		return "", fmt.Errorf("%w: field %q cannot hold the empty path %q", ErrTypeMismatch, definition.Name, value)
+	}
+
+	return strings.Join(parts, pathSeparator) + pathSeparator, nil
+}
+
+// checkPathSegmentField ensures every value of a path field has at least one part
+func checkPathSegmentField(definition *api.FieldDefinition, field *api.SegmentField) (*api.SegmentField, error) {
+	values, ok := stringValues(field)
+	if !ok {
+		return nil, typeMismatch(definition)
+	}
+
+	for _, value := range values {
+		if _, err := pathKey(definition, value); err != nil {
+			return nil, err
+		}
+	}
+	return field, nil
+}
+
+// pathRanges returns the prefix scans which find the segments on a path or its ancestors, and when descendants
+// are matched the segments on any path below it
+func pathRanges(definition *api.FieldDefinition, field *api.LookupField, descendants bool) ([]keyRange, error) {
+	segmentField, ok := lookupToSegmentField(field)
+	if !ok {
+		return nil, typeMismatch(definition)
+	}
+
+	values, ok := stringValues(segmentField)
+	if !ok {
+		return nil, typeMismatch(definition)
+	}
+
+	ranges := make([]keyRange, 0)
+	for _, value := range values {
+		key, err := pathKey(definition, value)
+		if err != nil {
+			return nil, err
+		}
+
+		// Each ancestor is scanned on its own, a zero byte suffix sorts directly after the key so nothing else matches
+		parts := strings.Split(strings.TrimSuffix(key, pathSeparator), pathSeparator)
+		for n := 1; n < len(parts); n++ {
+			ancestor := strings.Join(parts[:n], pathSeparator) + pathSeparator
+			ranges = append(ranges, keyRange{greaterOrEqual: ancestor, lessThan: ancestor + "\x00"})
+		}
+
+		if descendants {
+			// The separator is followed by "0" in byte order, so the scan stops after the last path below the key
+			ranges = append(ranges, keyRange{greaterOrEqual: key, lessThan: key[:len(key)-1] + "0"})
+		} else {
+			ranges = append(ranges, keyRange{greaterOrEqual: key, lessThan: key + "\x00"})
+		}
+	}
+	return ranges, nil
+}
+
+// marshallPath writes paths in their normalised form with a trailing separator
+func (s *Stringer) marshallPath() error {
+	field := s.segmentField
+	if field == nil {
+		converted, ok := lookupToSegmentField(s.lookupField)
+		if !ok {
+			return ErrFieldUnknown
+		}
+		field = converted
+	}
+
+	values, ok := stringValues(field)
+	if !ok {
+		return ErrFieldUnknown
+	}
+
+	for key, value := range values {
+		encoded, err := pathKey(s.fieldDefinition, value)
+		if err != nil {
+			return err
+		}
+
+		if !s.iter(strconv.Itoa(key), encoded) {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *Stringer) toPathField(value string) (*api.SegmentField, error) {
+	return &api.SegmentField{
+		Name: s.fieldDefinition.Name,
+		Value: &api.SegmentField_StringValue{
+			StringValue: &api.SegmentFieldString{
+				Value: strings.TrimSuffix(value, pathSeparator),
+			},
+		},
+	}, nil
+}
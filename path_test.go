@@ -0,0 +1,188 @@
+package db
+
+import (
+	"fmt"
+	api "github.com/segmentq/protos-api-go"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func testCategoryIndex(t *testing.T, db *DB, options map[string]*FieldOptions) *Index {
+	category := &FieldOptions{}
+	if options["category"] != nil {
+		category = options["category"]
+	}
+	category.Type = FieldTypePath
+
+	index, err := db.CreateIndexWithOptions(&api.IndexDefinition{
+		Name: "categories",
+		Fields: []*api.FieldDefinition{
+			{
+				Name:      "name",
+				DataType:  &api.FieldDefinition_Scalar{Scalar: api.ScalarType_DATA_TYPE_STRING},
+				IsPrimary: true,
+			},
+			scalarField("category", api.ScalarType_DATA_TYPE_STRING),
+		},
+	}, map[string]*FieldOptions{"category": category})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return index
+}
+
+func getCategorySegment(name string, categories ...string) *api.Segment {
+	return &api.Segment{
+		Fields: []*api.SegmentField{
+			{
+				Name:  "name",
+				Value: &api.SegmentField_StringValue{StringValue: &api.SegmentFieldString{Value: name}},
+			},
+			{
+				Name: "category",
+				Value: &api.SegmentField_RepeatedStringValue{
+					RepeatedStringValue: &api.SegmentFieldRepeatedString{Value: categories},
+				},
+			},
+		},
+	}
+}
+
+func testCategoryLookup(path string) *api.Lookup {
+	return &api.Lookup{
+		Fields: []*api.LookupField{
+			{
+				Name:  "category",
+				Value: &api.LookupField_StringValue{StringValue: &api.SegmentFieldString{Value: path}},
+			},
+		},
+	}
+}
+
+func testInsertCategories(t *testing.T, index *Index) {
+	segments := []*api.Segment{
+		getCategorySegment("sports", "sports"),
+		getCategorySegment("football", "sports/football", "sports/football/championship"),
+		getCategorySegment("premier", "/sports/football/premier-league/"),
+		getCategorySegment("sportswear", "sportswear"),
+	}
+	for _, segment := range segments {
+		if _, err := index.InsertSegment(segment); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDB_Lookup_Path(t *testing.T) {
+	d := testNewDB(t)
+	index := testCategoryIndex(t, d, nil)
+	testInsertCategories(t, index)
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{path: "sports/football/premier-league", want: []string{"sports", "football", "premier"}},
+		{path: "sports/football/championship", want: []string{"sports", "football"}},
+		{path: "sports/tennis", want: []string{"sports"}},
+		{path: "sports", want: []string{"sports"}},
+		{path: "sportswear/shoes", want: []string{"sportswear"}},
+		{path: "music", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			it, err := index.Lookup(testCategoryLookup(tt.path))
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.ElementsMatchf(t, tt.want, testCollectKeys(t, it), fmt.Sprintf("Lookup(%s)", tt.path))
+		})
+	}
+}
+
+func TestDB_Lookup_PathDescendants(t *testing.T) {
+	d := testNewDB(t)
+	index := testCategoryIndex(t, d, map[string]*FieldOptions{"category": {MatchDescendants: true}})
+	testInsertCategories(t, index)
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{path: "sports", want: []string{"sports", "football", "premier"}},
+		{path: "sports/football", want: []string{"sports", "football", "premier"}},
+		{path: "sports/football/premier-league", want: []string{"sports", "football", "premier"}},
+		{path: "sports/tennis", want: []string{"sports"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			it, err := index.Lookup(testCategoryLookup(tt.path))
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.ElementsMatchf(t, tt.want, testCollectKeys(t, it), fmt.Sprintf("Lookup(%s)", tt.path))
+		})
+	}
+}
+
+func TestIndex_InsertSegment_EmptyPath(t *testing.T) {
+	d := testNewDB(t)
+	index := testCategoryIndex(t, d, nil)
+
+	_, err := index.InsertSegment(getCategorySegment("root", "/"))
+	assert.ErrorIs(t, err, ErrTypeMismatch)
+	assert.Contains(t, err.Error(), "category")
+}
+
+func TestDB_CreateIndexWithOptions_MatchDescendants(t *testing.T) {
+	d := testNewDB(t)
+	_, err := d.CreateIndexWithOptions(getAudienceIndex("audiences"), map[string]*FieldOptions{
+		"name": {MatchDescendants: true},
+	})
+	assert.ErrorIs(t, err, ErrInvalidFieldOptions)
+}
+
+func TestDB_Lookup_PathReopened(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "segments.db")
+	d := testReopenDB(t, path, nil)
+	testInsertCategories(t, testCategoryIndex(t, d, nil))
+
+	index, err := testReopenDB(t, path, d).GetIndexByName("categories")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	options, err := index.FieldOptions("category")
+	if assert.NoError(t, err) {
+		assert.Equal(t, FieldTypePath, options.Type)
+	}
+
+	it, err := index.Lookup(testCategoryLookup("sports/football/premier-league"))
+	if assert.NoError(t, err) {
+		assert.ElementsMatch(t, []string{"sports", "football", "premier"}, testCollectKeys(t, it))
+	}
+}
+
+func TestStringer_toPathField(t *testing.T) {
+	definition := scalarField("category", api.ScalarType_DATA_TYPE_STRING)
+
+	var encoded string
+	err := NewSegmentStringer(&api.SegmentField{
+		Name:  "category",
+		Value: &api.SegmentField_StringValue{StringValue: &api.SegmentFieldString{Value: "/sports//football/"}},
+	}, func(_, value string) bool {
+		encoded = value
+		return true
+	}).withDefinition(definition).withType(FieldTypePath).MarshallText()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "sports/football/", encoded)
+
+	got, err := NewFieldDefinitionStringer(definition).withType(FieldTypePath).UnmarshallText(encoded)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "sports/football", got.GetStringValue().GetValue())
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	api "github.com/segmentq/protos-api-go"
+	"math"
+	"sort"
+)
+
+// plan orders queries by their estimated number of matches, so the most selective are evaluated first
+func plan(e *evaluator, queries []Query) ([]Query, []int64) {
+	costs := make([]int64, len(queries))
+	order := make([]int, len(queries))
+	for n, query := range queries {
+		costs[n] = query.cost(e)
+		order[n] = n
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		return costs[order[a]] < costs[order[b]]
+	})
+
+	planned := make([]Query, len(queries))
+	plannedCosts := make([]int64, len(queries))
+	for n, index := range order {
+		planned[n] = queries[index]
+		plannedCosts[n] = costs[index]
+	}
+
+	return planned, plannedCosts
+}
+
+// equalityPivots returns the encoded lookup values when a lookup is an exact match of scalar values, which the
+// field statistics can count
+func equalityPivots(definition *api.FieldDefinition, field *api.LookupField, operator Operator,
+	options *FieldOptions) ([]string, bool) {
+	if operator != OperatorEqual {
+		return nil, false
+	}
+
+	if _, ok := definition.GetDataType().(*api.FieldDefinition_Scalar); !ok {
+		return nil, false
+	}
+
+	if isGeoLookupField(field) || isPathScalar(definition, options.fieldType()) || isTemporalBetween(definition, options.fieldType(), field) ||
+		isIPBetween(definition, options.fieldType(), field) {
+		return nil, false
+	}
+
+	pivots, err := lookupPivots(definition, field, options)
+	if err != nil {
+		return nil, false
+	}
+
+	return pivots, true
+}
+
+func (q *matchQuery) cost(e *evaluator) int64 {
+	operator := q.resolve(e)
+	definition, field, options, err := e.t.prepareField(q.field, operator)
+	if err != nil {
+		// Invalid fields are evaluated first so the error is returned without scanning anything else
+		return 0
+	}
+
+	var cost int64
+	if options.missingMatchesAny() || e.t.l.db.excludedBy(e.t.idx, field.Name) != "" {
+		markers, _ := readValueCount(e.tx, e.indexId, unconstrainedFields, field.Name)
+		cost += markers
+	}
+
+	if pivots, ok := equalityPivots(definition, field, operator, options); ok {
+		for _, pivot := range pivots {
+			count, _ := readValueCount(e.tx, e.indexId, field.Name,
+				countedValue(pivot, foldsCase(definition, options.fieldType())))
+			cost += count
+		}
+		return cost
+	}
+
+	// Without an exact count any value in the field index could match
+	stats, err := readFieldStats(e.tx, e.indexId, field.Name)
+	if err != nil {
+		return cost
+	}
+	return cost + stats.Entries
+}
+
+func (q *andQuery) cost(e *evaluator) int64 {
+	cost := int64(math.MaxInt64)
+	for _, query := range q.queries {
+		if _, ok := query.(*notQuery); ok {
+			continue
+		}
+		if c := query.cost(e); c < cost {
+			cost = c
+		}
+	}
+	return cost
+}
+
+func (q *orQuery) cost(e *evaluator) int64 {
+	var cost int64
+	for _, query := range q.queries {
+		c := query.cost(e)
+		if c > math.MaxInt64-cost {
+			return math.MaxInt64
+		}
+		cost += c
+	}
+	return cost
+}
+
+func (q *notQuery) cost(*evaluator) int64 {
+	// Negations match every segment the query does not, which is assumed to be most of them
+	return math.MaxInt64
+}
@@ -0,0 +1,236 @@
+package db
+
+import (
+	"fmt"
+	api "github.com/segmentq/protos-api-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/buntdb"
+	"testing"
+)
+
+func testActiveIndex(t *testing.T, db *DB, count int) *Index {
+	index, err := db.CreateIndex(&api.IndexDefinition{
+		Name: "active",
+		Fields: []*api.FieldDefinition{
+			{
+				Name:      "name",
+				DataType:  &api.FieldDefinition_Scalar{Scalar: api.ScalarType_DATA_TYPE_STRING},
+				IsPrimary: true,
+			},
+			scalarField("active", api.ScalarType_DATA_TYPE_BOOL),
+			scalarField("country", api.ScalarType_DATA_TYPE_STRING),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for n := 0; n < count; n++ {
+		segment := getSingleFieldSegment(fmt.Sprintf("segment-%d", n))
+		segment.Fields = append(segment.Fields,
+			&api.SegmentField{
+				Name:  "active",
+				Value: &api.SegmentField_BoolValue{BoolValue: &api.SegmentFieldBool{Value: n%10 != 0}},
+			},
+			stringSegmentField("country", []string{"GB", "FR", "DE"}[n%3]),
+		)
+		if _, err = index.InsertSegment(segment); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return index
+}
+
+func boolLookupField(name string, value bool) *api.LookupField {
+	return &api.LookupField{
+		Name:  name,
+		Value: &api.LookupField_BoolValue{BoolValue: &api.SegmentFieldBool{Value: value}},
+	}
+}
+
+func TestIndex_FieldStats(t *testing.T) {
+	d := testNewDB(t)
+	index := testActiveIndex(t, d, 30)
+
+	stats, err := index.FieldStats("country")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, &FieldStats{Entries: 30, Distinct: 3}, stats)
+
+	// Deleting every segment holding a value removes it from the distinct count
+	for n := 0; n < 30; n += 3 {
+		_, err = index.DeleteSegment(fmt.Sprintf("segment-%d", n))
+		if !assert.NoError(t, err) {
+			return
+		}
+	}
+
+	stats, err = index.FieldStats("country")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, &FieldStats{Entries: 20, Distinct: 2}, stats)
+
+	_, err = index.FieldStats("region")
+	assert.ErrorIs(t, err, ErrFieldUnknown)
+
+	assert.NoError(t, index.Truncate())
+	stats, err = index.FieldStats("country")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, &FieldStats{}, stats)
+}
+
+func TestIndex_FieldStats_Reinsert(t *testing.T) {
+	d := testNewDB(t)
+	index, err := d.CreateIndex(&api.IndexDefinition{
+		Name: "tagged",
+		Fields: []*api.FieldDefinition{
+			{
+				Name:      "name",
+				DataType:  &api.FieldDefinition_Scalar{Scalar: api.ScalarType_DATA_TYPE_STRING},
+				IsPrimary: true,
+			},
+			scalarField("tags", api.ScalarType_DATA_TYPE_STRING),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The segment is inserted again under the same key with fewer values
+	for _, tags := range [][]string{{"news", "sports", "weather"}, {"news"}} {
+		segment := getSingleFieldSegment("segment-0")
+		segment.Fields = append(segment.Fields, &api.SegmentField{
+			Name: "tags",
+			Value: &api.SegmentField_RepeatedStringValue{
+				RepeatedStringValue: &api.SegmentFieldRepeatedString{Value: tags},
+			},
+		})
+		if _, err = index.InsertSegment(segment); !assert.NoError(t, err) {
+			return
+		}
+	}
+
+	stats, err := index.FieldStats("tags")
+	if assert.NoError(t, err) {
+		assert.Equal(t, &FieldStats{Entries: 1, Distinct: 1}, stats)
+	}
+
+	stats, err = index.FieldStats("name")
+	if assert.NoError(t, err) {
+		assert.Equal(t, &FieldStats{Entries: 1, Distinct: 1}, stats)
+	}
+
+	it, err := index.Lookup(&api.Lookup{Fields: []*api.LookupField{stringLookupField("tags", "sports")}})
+	if assert.NoError(t, err) {
+		assert.Empty(t, testCollectKeys(t, it))
+	}
+}
+
+func TestIndex_FieldStats_Case(t *testing.T) {
+	d := testNewDB(t)
+	index := testActiveIndex(t, d, 0)
+
+	// String indexes ignore case, so values which differ only in case are one value
+	for n, country := range []string{"London", "london", "LONDON", "Paris"} {
+		segment := getSingleFieldSegment(fmt.Sprintf("segment-%d", n))
+		segment.Fields = append(segment.Fields, stringSegmentField("country", country))
+		if _, err := index.InsertSegment(segment); !assert.NoError(t, err) {
+			return
+		}
+	}
+
+	stats, err := index.FieldStats("country")
+	if assert.NoError(t, err) {
+		assert.Equal(t, &FieldStats{Entries: 4, Distinct: 2}, stats)
+	}
+
+	it := &Iterator{idx: index.definition.Name, l: newLookup(d, index, nil, true)}
+	err = d.engine.View(func(tx *buntdb.Tx) error {
+		indexId, err := tx.Get(idxKey(idxById, index.definition.Name), true)
+		if err != nil {
+			return err
+		}
+
+		e := newEvaluator(it, tx, indexId)
+		assert.Equal(t, int64(3), Match(stringLookupField("country", "LoNdOn")).cost(e))
+		assert.Equal(t, int64(1), Match(stringLookupField("country", "paris")).cost(e))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	for _, key := range []string{"segment-0", "segment-1"} {
+		if _, err = index.DeleteSegment(key); !assert.NoError(t, err) {
+			return
+		}
+	}
+
+	stats, err = index.FieldStats("country")
+	if assert.NoError(t, err) {
+		assert.Equal(t, &FieldStats{Entries: 2, Distinct: 2}, stats)
+	}
+}
+
+func Test_plan(t *testing.T) {
+	d := testNewDB(t)
+	index := testActiveIndex(t, d, 30)
+
+	active := Match(boolLookupField("active", true))
+	name := Match(stringLookupField("name", "segment-4"))
+	country := Match(stringLookupField("country", "GB"))
+
+	l := newLookup(d, index, nil, true)
+	it := &Iterator{idx: index.definition.Name, l: l}
+
+	err := d.engine.View(func(tx *buntdb.Tx) error {
+		indexId, err := tx.Get(idxKey(idxById, index.definition.Name), true)
+		if err != nil {
+			return err
+		}
+
+		planned, costs := plan(newEvaluator(it, tx, indexId), []Query{active, country, name})
+		assert.Equal(t, []Query{name, country, active}, planned)
+		assert.Equal(t, []int64{1, 10, 27}, costs)
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestDB_Lookup_Planned(t *testing.T) {
+	d := testNewDB(t)
+	index := testActiveIndex(t, d, 30)
+
+	tests := []struct {
+		name   string
+		fields []*api.LookupField
+		want   []string
+	}{
+		{
+			name:   "common value first is checked against the selective field",
+			fields: []*api.LookupField{boolLookupField("active", true), stringLookupField("name", "SEGMENT-4")},
+			want:   []string{"segment-4"},
+		},
+		{
+			name:   "check drops candidates",
+			fields: []*api.LookupField{boolLookupField("active", false), stringLookupField("name", "segment-4")},
+			want:   []string{},
+		},
+		{
+			name:   "check of repeated lookup values",
+			fields: []*api.LookupField{stringLookupField("country", "FR"), boolLookupField("active", false)},
+			want:   []string{"segment-10"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it, err := index.Lookup(&api.Lookup{Fields: tt.fields})
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.ElementsMatch(t, tt.want, testCollectKeys(t, it))
+		})
+	}
+}
@@ -0,0 +1,436 @@
+package db
+
+import (
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	api "github.com/segmentq/protos-api-go"
+	"github.com/tidwall/buntdb"
+	"strconv"
+	"strings"
+)
+
+// Query is a node of a lookup query tree, one query streams the candidate segments and the tree is tested against
+// each of them
+type Query interface {
+	// candidates visits each segment the query matches once, it may also visit segments which test rejects
+	candidates(e *evaluator, iter func(key string) bool) error
+
+	// test reports whether the query matches a segment
+	test(e *evaluator, key string) (bool, error)
+
+	// cost estimates the number of segments the query matches
+	cost(e *evaluator) int64
+
+	fmt.Stringer
+}
+
+// evaluator holds the state shared by the nodes of a query tree while it is evaluated
+type evaluator struct {
+	t       *Iterator
+	tx      *buntdb.Tx
+	indexId string
+	checks  map[*matchQuery]*matchCheck
+
+	// scanned counts the engine index entries visited for candidates
+	scanned int64
+}
+
+func newEvaluator(t *Iterator, tx *buntdb.Tx, indexId string) *evaluator {
+	return &evaluator{
+		t:       t,
+		tx:      tx,
+		indexId: indexId,
+		checks:  make(map[*matchQuery]*matchCheck),
+	}
+}
+
+// all visits the key of every segment in the index, which NOT is evaluated against
+func (e *evaluator) all(iter func(key string) bool) error {
+	prefix := idxKey(segmentByPrimaryKey, e.indexId) + idxSep
+	err := e.tx.Ascend(idxKey(segmentByPrimaryKey, e.indexId), func(key, _ string) bool {
+		e.scanned++
+		return iter(strings.TrimPrefix(key, prefix))
+	})
+	if err != nil {
+		return ErrLookupFailure
+	}
+	return nil
+}
+
+type matchQuery struct {
+	field    *api.LookupField
+	operator *Operator
+}
+
+// Match matches the segments holding the lookup field, compared with the operator set by WithOperator or equality
+func Match(field *api.LookupField) Query {
+	return &matchQuery{field: field}
+}
+
+// Compare matches the segments holding a value of the lookup field which satisfies the operator
+func Compare(field *api.LookupField, operator Operator) Query {
+	return &matchQuery{field: field, operator: &operator}
+}
+
+func (q *matchQuery) String() string {
+	if q.operator == nil {
+		return fmt.Sprintf("match{%s}", proto.CompactTextString(q.field))
+	}
+	return fmt.Sprintf("compare[%s]{%s}", *q.operator, proto.CompactTextString(q.field))
+}
+
+// resolve returns the operator of the query, falling back to the one set for the field by WithOperator
+func (q *matchQuery) resolve(e *evaluator) Operator {
+	if q.operator != nil {
+		return *q.operator
+	}
+	return e.t.l.operators[q.field.Name]
+}
+
+// matchCheck is a match query prepared to test candidates, it is built once per evaluation
+type matchCheck struct {
+	field  *fieldTest
+	marked bool
+
+	excludedBy string
+	excludes   *fieldTest
+}
+
+// check returns the prepared test of the match query
+func (q *matchQuery) check(e *evaluator) (*matchCheck, error) {
+	if check, ok := e.checks[q]; ok {
+		return check, nil
+	}
+
+	operator := q.resolve(e)
+	field, err := e.t.newFieldTest(q.field, operator)
+	if err != nil {
+		return nil, err
+	}
+
+	// Segments which omit the field, or only exclude values of it, match whatever it is compared with
+	excludedBy := e.t.l.db.excludedBy(e.t.idx, q.field.Name)
+	check := &matchCheck{
+		field:      field,
+		marked:     excludedBy != "" || e.t.l.db.options[e.t.idx][q.field.Name].missingMatchesAny(),
+		excludedBy: excludedBy,
+	}
+
+	// Segments holding the value in the field of exclusions are dropped
+	if excludedBy != "" {
+		exclusion := proto.Clone(q.field).(*api.LookupField)
+		exclusion.Name = excludedBy
+
+		if check.excludes, err = e.t.newFieldTest(exclusion, operator); err != nil {
+			return nil, err
+		}
+	}
+
+	e.checks[q] = check
+	return check, nil
+}
+
+func (q *matchQuery) candidates(e *evaluator, iter func(key string) bool) error {
+	check, err := q.check(e)
+	if err != nil {
+		return err
+	}
+
+	var visitErr error
+	stopped := false
+	visit := func(key, _ string) bool {
+		e.scanned++
+		keyObject := keyFromString(key)
+		k, ok := keyObject.SegmentKey()
+		if !ok {
+			return true
+		}
+		index, _ := keyObject.FieldValueIndex()
+		n, err := strconv.Atoi(index)
+		if err != nil {
+			return true
+		}
+
+		// A segment is visited once per matching value, it is passed on for the first of them
+		for m := 0; m < n; m++ {
+			value, err := e.tx.Get(idxKey(e.indexId, q.field.Name, k, strconv.Itoa(m)), true)
+			if err == nil && check.field.visits(value) {
+				return true
+			}
+		}
+
+		stopped = !iter(k)
+		return !stopped
+	}
+
+	if err = e.t.scanField(e.tx, e.indexId, q.field, q.resolve(e), visit); err != nil {
+		return err
+	}
+	if stopped || !check.marked {
+		return nil
+	}
+
+	err = e.tx.AscendEqual(idxKey(e.indexId, unconstrainedFields), q.field.Name, func(key, value string) bool {
+		e.scanned++
+
+		keyObject := keyFromString(key)
+		k, ok := keyObject.SegmentKey()
+		if !ok {
+			return true
+		}
+
+		// Segments holding matching values were visited by the field scan
+		values, err := readValues(e.tx, e.indexId, q.field.Name, k)
+		if err != nil {
+			visitErr = err
+			return false
+		}
+		if check.field.accepts(values) {
+			return true
+		}
+
+		return iter(k)
+	})
+	if err != nil {
+		return ErrLookupFailure
+	}
+
+	return visitErr
+}
+
+func (q *matchQuery) test(e *evaluator, key string) (bool, error) {
+	check, err := q.check(e)
+	if err != nil {
+		return false, err
+	}
+
+	values, err := readValues(e.tx, e.indexId, q.field.Name, key)
+	if err != nil {
+		return false, err
+	}
+
+	matched := check.field.accepts(values)
+	if !matched && check.marked {
+		if matched, err = hasMarker(e.tx, e.indexId, q.field.Name, key); err != nil {
+			return false, err
+		}
+	}
+
+	if !matched || check.excludes == nil {
+		return matched, nil
+	}
+
+	excluded, err := readValues(e.tx, e.indexId, check.excludedBy, key)
+	if err != nil {
+		return false, err
+	}
+	return !check.excludes.accepts(excluded), nil
+}
+
+// hasMarker reports whether a segment matches any lookup of a field it omits or excludes values of
+func hasMarker(tx *buntdb.Tx, indexId string, field string, key string) (bool, error) {
+	markers, err := readValues(tx, indexId, unconstrainedFields, key)
+	if err != nil {
+		return false, err
+	}
+
+	for _, marker := range markers {
+		if marker == field {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type andQuery struct {
+	queries []Query
+}
+
+// And matches the segments matched by every query
+func And(queries ...Query) Query {
+	return &andQuery{queries: queries}
+}
+
+func (q *andQuery) String() string {
+	return "and(" + joinQueries(q.queries) + ")"
+}
+
+// driver returns the query whose candidates an And streams, the cheapest of its queries which are not negations
+func (q *andQuery) driver(e *evaluator) (Query, bool) {
+	included := make([]Query, 0, len(q.queries))
+	for _, query := range q.queries {
+		if _, ok := query.(*notQuery); !ok {
+			included = append(included, query)
+		}
+	}
+
+	if len(included) == 0 {
+		return nil, false
+	}
+
+	planned, _ := plan(e, included)
+	return planned[0], true
+}
+
+func (q *andQuery) candidates(e *evaluator, iter func(key string) bool) error {
+	if driver, ok := q.driver(e); ok {
+		return driver.candidates(e, iter)
+	}
+
+	// Only negations are left, which are evaluated against every segment
+	if len(q.queries) == 0 {
+		return nil
+	}
+	return e.all(iter)
+}
+
+func (q *andQuery) test(e *evaluator, key string) (bool, error) {
+	if len(q.queries) == 0 {
+		return false, nil
+	}
+
+	for _, query := range q.queries {
+		ok, err := query.test(e, key)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+type orQuery struct {
+	queries []Query
+}
+
+// Or matches the segments matched by any of the queries
+func Or(queries ...Query) Query {
+	return &orQuery{queries: queries}
+}
+
+func (q *orQuery) String() string {
+	return "or(" + joinQueries(q.queries) + ")"
+}
+
+func (q *orQuery) candidates(e *evaluator, iter func(key string) bool) error {
+	// Segments are visited once however many of the queries match them, a single set of the keys already visited is
+	// kept rather than testing each candidate against every earlier query
+	visited := make(map[string]struct{})
+	for _, query := range q.queries {
+		stopped := false
+		err := query.candidates(e, func(key string) bool {
+			if _, ok := visited[key]; ok {
+				return true
+			}
+			visited[key] = struct{}{}
+
+			stopped = !iter(key)
+			return !stopped
+		})
+		if err != nil {
+			return err
+		}
+		if stopped {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (q *orQuery) test(e *evaluator, key string) (bool, error) {
+	for _, query := range q.queries {
+		ok, err := query.test(e, key)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+type notQuery struct {
+	query Query
+}
+
+// Not matches the segments which the query does not, within an And only the segments matched by its other queries
+// are considered
+func Not(query Query) Query {
+	return &notQuery{query: query}
+}
+
+func (q *notQuery) String() string {
+	return "not(" + q.query.String() + ")"
+}
+
+func (q *notQuery) candidates(e *evaluator, iter func(key string) bool) error {
+	return e.all(iter)
+}
+
+func (q *notQuery) test(e *evaluator, key string) (bool, error) {
+	ok, err := q.query.test(e, key)
+	return !ok && err == nil, err
+}
+
+// joinQueries lists the queries of an And or Or
+func joinQueries(queries []Query) string {
+	parts := make([]string, 0, len(queries))
+	for _, query := range queries {
+		parts = append(parts, query.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// prepare builds the checks of every match in the tree, so an invalid lookup fails before anything is scanned
+func prepare(e *evaluator, query Query) error {
+	switch q := query.(type) {
+	case *matchQuery:
+		_, err := q.check(e)
+		return err
+	case *andQuery:
+		for _, query := range q.queries {
+			if err := prepare(e, query); err != nil {
+				return err
+			}
+		}
+	case *orQuery:
+		for _, query := range q.queries {
+			if err := prepare(e, query); err != nil {
+				return err
+			}
+		}
+	case *notQuery:
+		return prepare(e, q.query)
+	case *scoreQuery:
+		for _, query := range q.fields {
+			if err := prepare(e, query); err != nil {
+				return err
+			}
+		}
+		if q.required != nil {
+			return prepare(e, q.required)
+		}
+	}
+	return nil
+}
+
+// tree returns the query tree of the lookup, the fields of the lookup are ANDed with any query set by WithQuery
+// unless the lookup is scored
+func (l *Lookup) tree() Query {
+	queries := make([]Query, 0, len(l.lookup.GetFields())+1)
+	for _, field := range l.lookup.GetFields() {
+		queries = append(queries, Match(field))
+	}
+
+	// Scored lookups match segments by the weights of their fields rather than every field
+	if l.scoring != nil {
+		weights := make([]float64, 0, len(queries))
+		for _, field := range l.lookup.GetFields() {
+			weights = append(weights, l.scoring.weight(field.Name))
+		}
+		return &scoreQuery{fields: queries, weights: weights, minimum: l.scoring.minimum, required: l.query}
+	}
+
+	if l.query != nil {
+		queries = append(queries, l.query)
+	}
+
+	return And(queries...)
+}
@@ -0,0 +1,136 @@
+package db
+
+import (
+	api "github.com/segmentq/protos-api-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func testAudienceQueryIndex(t *testing.T, db *DB) *Index {
+	index, err := db.CreateIndex(&api.IndexDefinition{
+		Name: "audiences",
+		Fields: []*api.FieldDefinition{
+			{
+				Name:      "name",
+				DataType:  &api.FieldDefinition_Scalar{Scalar: api.ScalarType_DATA_TYPE_STRING},
+				IsPrimary: true,
+			},
+			scalarField("country", api.ScalarType_DATA_TYPE_STRING),
+			scalarField("device", api.ScalarType_DATA_TYPE_STRING),
+			scalarField("age", api.ScalarType_DATA_TYPE_INT),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	audiences := []struct {
+		name, country, device string
+		age                   int64
+	}{
+		{name: "gb-ios-adult", country: "GB", device: "ios", age: 30},
+		{name: "gb-android-teen", country: "GB", device: "android", age: 15},
+		{name: "gb-android-adult", country: "GB", device: "android", age: 40},
+		{name: "gb-desktop-adult", country: "GB", device: "desktop", age: 25},
+		{name: "fr-ios-adult", country: "FR", device: "ios", age: 30},
+	}
+	for _, audience := range audiences {
+		segment := getSingleFieldSegment(audience.name)
+		segment.Fields = append(segment.Fields,
+			stringSegmentField("country", audience.country),
+			stringSegmentField("device", audience.device),
+			intSegmentField("age", audience.age),
+		)
+		if _, err = index.InsertSegment(segment); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return index
+}
+
+func stringSegmentField(name, value string) *api.SegmentField {
+	return &api.SegmentField{
+		Name:  name,
+		Value: &api.SegmentField_StringValue{StringValue: &api.SegmentFieldString{Value: value}},
+	}
+}
+
+func stringLookupField(name, value string) *api.LookupField {
+	return &api.LookupField{
+		Name:  name,
+		Value: &api.LookupField_StringValue{StringValue: &api.SegmentFieldString{Value: value}},
+	}
+}
+
+func TestDB_Lookup_Query(t *testing.T) {
+	d := testNewDB(t)
+	index := testAudienceQueryIndex(t, d)
+
+	teen := &api.LookupField{
+		Name:  "age",
+		Value: &api.LookupField_RangeIntValue{RangeIntValue: &api.SegmentFieldRangeInt{Min: 13, Max: 17}},
+	}
+
+	tests := []struct {
+		name   string
+		lookup *api.Lookup
+		query  Query
+		want   []string
+	}{
+		{
+			name: "and, or and not",
+			query: And(
+				Match(stringLookupField("country", "GB")),
+				Or(Match(stringLookupField("device", "ios")), Match(stringLookupField("device", "android"))),
+				Not(Compare(teen, OperatorBetween)),
+			),
+			want: []string{"gb-ios-adult", "gb-android-adult"},
+		},
+		{
+			name:   "lookup fields are anded with the query",
+			lookup: &api.Lookup{Fields: []*api.LookupField{stringLookupField("device", "ios")}},
+			query:  Not(Match(stringLookupField("country", "GB"))),
+			want:   []string{"fr-ios-adult"},
+		},
+		{
+			name:  "not on its own",
+			query: Not(Match(stringLookupField("country", "GB"))),
+			want:  []string{"fr-ios-adult"},
+		},
+		{
+			name:  "or across fields",
+			query: Or(Match(stringLookupField("country", "FR")), Compare(teen, OperatorBetween)),
+			want:  []string{"fr-ios-adult", "gb-android-teen"},
+		},
+		{
+			name:  "or of overlapping queries",
+			query: Or(Match(stringLookupField("country", "GB")), Match(stringLookupField("device", "ios"))),
+			want:  []string{"gb-ios-adult", "gb-android-teen", "gb-android-adult", "gb-desktop-adult", "fr-ios-adult"},
+		},
+		{
+			name:  "nothing matches",
+			query: And(Match(stringLookupField("country", "FR")), Match(stringLookupField("device", "android"))),
+			want:  []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it, err := index.Lookup(tt.lookup, WithQuery(tt.query))
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.ElementsMatch(t, tt.want, testCollectKeys(t, it))
+		})
+	}
+}
+
+func TestDB_Lookup_QueryUnknownField(t *testing.T) {
+	d := testNewDB(t)
+	index := testAudienceQueryIndex(t, d)
+
+	it, err := index.Lookup(nil, WithQuery(Or(Match(stringLookupField("region", "EU")))))
+	assert.NoError(t, err)
+
+	_, err = it.Next(nil)
+	assert.ErrorIs(t, err, ErrFieldUnknown)
+}
@@ -0,0 +1,149 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// scoring holds the options of a lookup which ranks segments by the lookup fields they match
+type scoring struct {
+	minimum float64
+	weights map[string]float64
+}
+
+// WithScoring returns the segments matching at least the minimum score rather than every lookup field, ranked by
+// score. A segment scores the weight of each lookup field it matches, 1 unless set by WithWeight. Any query set by
+// WithQuery must still match. Segments with equal scores are ordered by key, descending like the scores.
+func WithScoring(minimum float64) LookupOption {
+	return func(l *Lookup) {
+		if l.scoring == nil {
+			l.scoring = &scoring{weights: make(map[string]float64)}
+		}
+		l.scoring.minimum = minimum
+	}
+}
+
+// WithWeight sets the score of matching the lookup fields with the given name in a lookup run WithScoring
+func WithWeight(field string, weight float64) LookupOption {
+	return func(l *Lookup) {
+		if l.scoring == nil {
+			l.scoring = &scoring{weights: make(map[string]float64)}
+		}
+		l.scoring.weights[field] = weight
+	}
+}
+
+// weight returns the score of matching a field
+func (s *scoring) weight(field string) float64 {
+	if weight, ok := s.weights[field]; ok {
+		return weight
+	}
+	return 1
+}
+
+// String describes the scoring options, weights in the order of their field names
+func (s *scoring) String() string {
+	fields := make([]string, 0, len(s.weights))
+	for field := range s.weights {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	weights := make([]string, 0, len(fields))
+	for _, field := range fields {
+		weights = append(weights, fmt.Sprintf("%s=%g", field, s.weights[field]))
+	}
+	return fmt.Sprintf("minimum %g, weights [%s]", s.minimum, strings.Join(weights, ", "))
+}
+
+// scoreOrder orders scored results by score, the greatest first
+func scoreOrder(query *scoreQuery) *order {
+	return &order{
+		less: func(a, b string) bool {
+			scoreA, _ := strconv.ParseFloat(a, 64)
+			scoreB, _ := strconv.ParseFloat(b, 64)
+			return scoreA < scoreB
+		},
+		descending: true,
+		score: func(e *evaluator, key string) (entry, error) {
+			score, err := query.score(e, key)
+			if err != nil {
+				return entry{}, err
+			}
+			return entry{key: key, value: strconv.FormatFloat(score, 'g', -1, 64)}, nil
+		},
+	}
+}
+
+type scoreQuery struct {
+	fields   []Query
+	weights  []float64
+	minimum  float64
+	required Query
+}
+
+func (q *scoreQuery) String() string {
+	required := ""
+	if q.required != nil {
+		required = ", " + q.required.String()
+	}
+	return fmt.Sprintf("score[%g](%s%s)", q.minimum, joinQueries(q.fields), required)
+}
+
+// score sums the weights of the fields a segment matches
+func (q *scoreQuery) score(e *evaluator, key string) (float64, error) {
+	var score float64
+	for n, field := range q.fields {
+		ok, err := field.test(e, key)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			score += q.weights[n]
+		}
+	}
+	return score, nil
+}
+
+func (q *scoreQuery) candidates(e *evaluator, iter func(key string) bool) error {
+	// Segments matching no field can only reach a minimum of 0 or less
+	if q.minimum <= 0 {
+		if q.required != nil {
+			return q.required.candidates(e, iter)
+		}
+		return e.all(iter)
+	}
+
+	if q.required != nil && q.required.cost(e) < Or(q.fields...).cost(e) {
+		return q.required.candidates(e, iter)
+	}
+	return Or(q.fields...).candidates(e, iter)
+}
+
+func (q *scoreQuery) test(e *evaluator, key string) (bool, error) {
+	if q.required != nil {
+		ok, err := q.required.test(e, key)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	score, err := q.score(e, key)
+	if err != nil {
+		return false, err
+	}
+	return score >= q.minimum, nil
+}
+
+func (q *scoreQuery) cost(e *evaluator) int64 {
+	if q.required != nil {
+		return q.required.cost(e)
+	}
+	if q.minimum <= 0 {
+		return math.MaxInt64
+	}
+	return Or(q.fields...).cost(e)
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	api "github.com/segmentq/protos-api-go"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/iterator"
+	"testing"
+)
+
+func TestIndex_Lookup_WithScoring(t *testing.T) {
+	d := testNewDB(t)
+	index := testAudienceQueryIndex(t, d)
+	lookup := &api.Lookup{Fields: []*api.LookupField{
+		stringLookupField("country", "GB"),
+		stringLookupField("device", "ios"),
+		intLookupField("age", 30),
+	}}
+
+	tests := []struct {
+		name       string
+		opts       []LookupOption
+		want       []string
+		wantScores []float64
+	}{
+		{
+			name:       "minimum should match",
+			opts:       []LookupOption{WithScoring(2)},
+			want:       []string{"gb-ios-adult", "fr-ios-adult"},
+			wantScores: []float64{3, 2},
+		},
+		{
+			name:       "equal scores ordered by key",
+			opts:       []LookupOption{WithScoring(1)},
+			want:       []string{"gb-ios-adult", "fr-ios-adult", "gb-desktop-adult", "gb-android-teen", "gb-android-adult"},
+			wantScores: []float64{3, 2, 1, 1, 1},
+		},
+		{
+			name:       "weighted",
+			opts:       []LookupOption{WithScoring(3), WithWeight("country", 3)},
+			want:       []string{"gb-ios-adult", "gb-desktop-adult", "gb-android-teen", "gb-android-adult"},
+			wantScores: []float64{5, 3, 3, 3},
+		},
+		{
+			name:       "required query",
+			opts:       []LookupOption{WithScoring(1), WithQuery(Match(stringLookupField("country", "FR")))},
+			want:       []string{"fr-ios-adult"},
+			wantScores: []float64{2},
+		},
+		{
+			name:       "no minimum",
+			opts:       []LookupOption{WithWeight("device", 0.5), WithScoring(0)},
+			want:       []string{"gb-ios-adult", "fr-ios-adult", "gb-desktop-adult", "gb-android-teen", "gb-android-adult"},
+			wantScores: []float64{2.5, 1.5, 1, 1, 1},
+		},
+		{
+			name: "nothing reaches the minimum",
+			opts: []LookupOption{WithScoring(4)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it, err := index.Lookup(lookup, tt.opts...)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			keys, scores := make([]string, 0), make([]float64, 0)
+			for {
+				key, err := it.Next(nil)
+				if err == iterator.Done || err == ErrLookupEmpty {
+					break
+				}
+				if !assert.NoError(t, err) {
+					return
+				}
+				keys = append(keys, key)
+				scores = append(scores, it.Score())
+			}
+
+			if len(tt.want) == 0 {
+				assert.Empty(t, keys)
+				return
+			}
+			assert.Equal(t, tt.want, keys)
+			assert.Equal(t, tt.wantScores, scores)
+		})
+	}
+}
+
+func TestIndex_Lookup_WithScoring_Pages(t *testing.T) {
+	d := testNewDB(t)
+	index := testAudienceQueryIndex(t, d)
+	lookup := &api.Lookup{Fields: []*api.LookupField{
+		stringLookupField("country", "GB"),
+		stringLookupField("device", "ios"),
+	}}
+
+	keys := make([]string, 0)
+	cursor := ""
+	for {
+		it, err := index.Lookup(lookup, WithScoring(1), WithPage(2, cursor))
+		if !assert.NoError(t, err) {
+			return
+		}
+		keys = append(keys, testCollectKeys(t, it)...)
+
+		if cursor = it.Cursor(); cursor == "" {
+			break
+		}
+	}
+	assert.Equal(t, []string{"gb-ios-adult", "gb-desktop-adult", "gb-android-teen", "gb-android-adult",
+		"fr-ios-adult"}, keys)
+
+	_, err := index.Lookup(lookup, WithScoring(1), WithSort("age", false))
+	assert.ErrorIs(t, err, ErrInvalidSort)
+
+	count, err := index.Count(lookup, WithScoring(2))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func intLookupField(name string, value int64) *api.LookupField {
+	return &api.LookupField{
+		Name:  name,
+		Value: &api.LookupField_IntValue{IntValue: &api.SegmentFieldInt{Value: value}},
+	}
+}
@@ -1,11 +1,15 @@
 package db
 
 import (
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"github.com/golang/protobuf/proto"
 	api "github.com/segmentq/protos-api-go"
 	"github.com/tidwall/buntdb"
+	"reflect"
 	"strconv"
+	"strings"
 )
 
 type Segment struct {
@@ -145,14 +149,17 @@ type deleteSegmentTxn struct {
 	indexName string
 	key       string
 	valueMap  map[string]map[string]string
+	folded    map[string]bool
 	segment   *api.Segment
 }
 
-func newDeleteSegmentTxn(indexName string, key string, valueMap map[string]map[string]string, segment *api.Segment) *deleteSegmentTxn {
+func newDeleteSegmentTxn(indexName string, key string, valueMap map[string]map[string]string, folded map[string]bool,
+	segment *api.Segment) *deleteSegmentTxn {
 	return &deleteSegmentTxn{
 		indexName: indexName,
 		key:       key,
 		valueMap:  valueMap,
+		folded:    folded,
 		segment:   segment,
 	}
 }
@@ -180,7 +187,7 @@ func (t *deleteSegmentTxn) call(tx *buntdb.Tx) error {
 		return ErrInternalDBError
 	}
 
-	return nil
+	return updateStats(tx, idx, t.valueMap, t.folded, -1)
 }
 
 func (s *Segment) deleteFromIndexName(indexName string) error {
@@ -192,7 +199,8 @@ func (s *Segment) deleteFromIndexName(indexName string) error {
 	key := deletes[primary]["0"]
 
 	txn := NewTxn(s.db, true)
-	txn.AddAction(newDeleteSegmentTxn(indexName, key, deletes, s.segment))
+	txn.AddAction(newDeleteSegmentTxn(indexName, key, deletes,
+		foldedFields(s.db.idx[indexName].GetFields(), s.db.options[indexName]), s.segment))
 
 	return txn.Settle()
 }
@@ -227,6 +235,10 @@ func (s *Segment) replaceInIndexName(indexName string, new *api.Segment) (*Segme
 		segment: new,
 	}
 
+	if err := r.materialise(indexName); err != nil {
+		return nil, err
+	}
+
 	primary, deletes, err := s.generateIndexMap(indexName)
 	if err != nil {
 		return nil, err
@@ -241,8 +253,10 @@ func (s *Segment) replaceInIndexName(indexName string, new *api.Segment) (*Segme
 	insertKey := inserts[primary]["0"]
 
 	txn := NewTxn(s.db, true)
-	txn.AddAction(newDeleteSegmentTxn(indexName, deleteKey, deletes, s.segment))
-	txn.AddAction(newInsertSegmentTxn(indexName, insertKey, inserts, r.segment))
+	txn.AddAction(newDeleteSegmentTxn(indexName, deleteKey, deletes,
+		foldedFields(s.db.idx[indexName].GetFields(), s.db.options[indexName]), s.segment))
+	txn.AddAction(newInsertSegmentTxn(indexName, insertKey, inserts, r.segment, s.db.options[indexName],
+		s.db.idx[indexName].GetFields()))
 
 	if err = txn.Settle(); err != nil {
 		return nil, err
@@ -272,14 +286,19 @@ type insertSegmentTxn struct {
 	key       string
 	valueMap  map[string]map[string]string
 	segment   *api.Segment
+	options   map[string]*FieldOptions
+	fields    []*api.FieldDefinition
 }
 
-func newInsertSegmentTxn(indexName string, key string, valueMap map[string]map[string]string, segment *api.Segment) *insertSegmentTxn {
+func newInsertSegmentTxn(indexName string, key string, valueMap map[string]map[string]string, segment *api.Segment,
+	options map[string]*FieldOptions, fields []*api.FieldDefinition) *insertSegmentTxn {
 	return &insertSegmentTxn{
 		indexName: indexName,
 		key:       key,
 		valueMap:  valueMap,
 		segment:   segment,
+		options:   options,
+		fields:    fields,
 	}
 }
 
@@ -290,6 +309,16 @@ func (t *insertSegmentTxn) call(tx *buntdb.Tx) error {
 		return ErrInternalDBError
 	}
 
+	// Unique values must be checked before any value is written
+	if err = t.checkUnique(tx, idx); err != nil {
+		return err
+	}
+
+	// A segment inserted again under its primary key drops the values it was indexed with first
+	if err = t.removePrevious(tx, idx); err != nil {
+		return err
+	}
+
 	// Make an insert into each index
 	// TODO do we allow repeated primary? Probably not
 	for fieldName, values := range t.valueMap {
@@ -307,10 +336,92 @@ func (t *insertSegmentTxn) call(tx *buntdb.Tx) error {
 		return ErrInternalDBError
 	}
 
+	return updateStats(tx, idx, t.valueMap, foldedFields(t.fields, t.options), 1)
+}
+
+// removePrevious deletes the values and statistics of a segment already stored under the key
+func (t *insertSegmentTxn) removePrevious(tx *buntdb.Tx, idx string) error {
+	_, err := tx.Get(idxKey(segmentByPrimaryKey, idx, t.key), true)
+	if err == buntdb.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return ErrInternalDBError
+	}
+
+	previous, err := readValueMap(tx, idx, t.fields, t.key)
+	if err != nil {
+		return err
+	}
+
+	return newDeleteSegmentTxn(t.indexName, t.key, previous, foldedFields(t.fields, t.options), nil).call(tx)
+}
+
+// readValueMap reads the values and markers a stored segment is indexed with, by field name and key as
+// generateIndexMap builds them
+func readValueMap(tx *buntdb.Tx, idx string, fields []*api.FieldDefinition, key string) (map[string]map[string]string,
+	error) {
+	names := make([]string, 0, len(fields)+1)
+	for _, field := range fields {
+		names = append(names, field.Name)
+	}
+	names = append(names, unconstrainedFields)
+
+	valueMap := make(map[string]map[string]string, len(names))
+	for _, name := range names {
+		values, err := readValues(tx, idx, name, key)
+		if err != nil {
+			return nil, ErrInternalDBError
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		keyMap := make(map[string]string, len(values))
+		for n, value := range values {
+			keyMap[strconv.Itoa(n)] = value
+		}
+		valueMap[name] = keyMap
+	}
+
+	return valueMap, nil
+}
+
+// checkUnique ensures no other segment holds a value for any of the unique fields
+func (t *insertSegmentTxn) checkUnique(tx *buntdb.Tx, idx string) error {
+	for fieldName, values := range t.valueMap {
+		if options, ok := t.options[fieldName]; !ok || !options.Unique {
+			continue
+		}
+
+		for _, value := range values {
+			var holder string
+			err := tx.AscendEqual(idxKey(idx, fieldName), value, func(key, _ string) bool {
+				keyObject := keyFromString(key)
+				if k, exists := keyObject.SegmentKey(); exists && k != t.key {
+					holder = k
+					return false
+				}
+				return true
+			})
+			if err != nil {
+				return ErrInternalDBError
+			}
+
+			if holder != "" {
+				return fmt.Errorf("%w: %s value %q is held by segment %q", ErrUniqueConflict, fieldName, value, holder)
+			}
+		}
+	}
+
 	return nil
 }
 
 func (s *Segment) insertToIndexName(indexName string) error {
+	if err := s.materialise(indexName); err != nil {
+		return err
+	}
+
 	primary, inserts, err := s.generateIndexMap(indexName)
 	if err != nil {
 		return err
@@ -319,16 +430,56 @@ func (s *Segment) insertToIndexName(indexName string) error {
 	key := inserts[primary]["0"]
 
 	txn := NewTxn(s.db, true)
-	txn.AddAction(newInsertSegmentTxn(indexName, key, inserts, s.segment))
+	txn.AddAction(newInsertSegmentTxn(indexName, key, inserts, s.segment, s.db.options[indexName],
+		s.db.idx[indexName].GetFields()))
 
 	return txn.Settle()
 }
 
+// materialise adds default values for fields the segment does not set and ensures required fields are present
+func (s *Segment) materialise(indexName string) error {
+	options, ok := s.db.options[indexName]
+	if !ok {
+		return nil
+	}
+
+	present := make(map[string]bool, len(s.segment.Fields))
+	for _, field := range s.segment.Fields {
+		present[field.Name] = true
+	}
+
+	cloned := false
+	for _, definition := range s.db.idx[indexName].GetFields() {
+		name := definition.Name
+		fieldOptions, ok := options[name]
+		if !ok || present[name] {
+			continue
+		}
+
+		if fieldOptions.Default != nil {
+			// Copy the segment so the callers proto is left untouched
+			if !cloned {
+				s.segment = proto.Clone(s.segment).(*api.Segment)
+				cloned = true
+			}
+			s.segment.Fields = append(s.segment.Fields, proto.Clone(fieldOptions.Default).(*api.SegmentField))
+			continue
+		}
+
+		if fieldOptions.Required {
+			return fmt.Errorf("%w: %s", ErrRequiredMissing, name)
+		}
+	}
+
+	return nil
+}
+
 func (s *Segment) generateIndexMap(indexName string) (primary string, inserts map[string]map[string]string, err error) {
 	// Gather the values by field name and key in a 0 based map
 	inserts = make(map[string]map[string]string, 0)
 
-	for _, field := range s.segment.Fields {
+	cloned := false
+	for n, field := range s.segment.Fields {
 		definition, exists := s.db.fields[indexName][field.Name]
 		if !exists {
 			if _, ok := s.db.fields[indexName]; !ok {
@@ -337,6 +488,27 @@ func (s *Segment) generateIndexMap(indexName string) (primary string, inserts ma
 			return "", nil, ErrFieldUnknown
 		}
 
+		// Ensure the value matches the field type, coerced values replace the original in a copy of the segment, which
+		// is made when the first field is coerced
+		options := s.db.options[indexName][field.Name]
+		checked, err := checkSegmentField(definition, field, options)
+		if err != nil {
+			return "", nil, err
+		}
+		if checked != field {
+			if !cloned {
+				s.segment = proto.Clone(s.segment).(*api.Segment)
+				cloned = true
+			}
+			s.segment.Fields[n] = checked
+			field = checked
+		}
+
+		// Fields which are not indexed are only stored with the whole segment
+		if !options.indexed() {
+			continue
+		}
+
 		// Note the primary key, so we can extract the correct value for the key name
 		if definition.IsPrimary {
 			primary = field.Name
@@ -346,7 +518,7 @@ func (s *Segment) generateIndexMap(indexName string) (primary string, inserts ma
 		stringer := NewSegmentStringer(field, func(key string, value string) bool {
 			keyMap[key] = value
 			return true
-		})
+		}).withDefinition(definition).withType(options.fieldType()).withCollation(options.collation())
 
 		if err = stringer.MarshallText(); err != nil {
 			return "", nil, ErrInternalDBError
@@ -355,6 +527,23 @@ func (s *Segment) generateIndexMap(indexName string) (primary string, inserts ma
 		inserts[field.Name] = keyMap
 	}
 
+	// Omitted fields which match any value are marked, so lookups find the segment through an index. A field is
+	// also unconstrained when the segment only holds values it excludes.
+	markers := make(map[string]string)
+	for _, definition := range s.db.idx[indexName].Fields {
+		if _, ok := inserts[definition.Name]; ok {
+			continue
+		}
+
+		_, hasExclusions := inserts[s.db.excludedBy(indexName, definition.Name)]
+		if hasExclusions || s.db.options[indexName][definition.Name].missingMatchesAny() {
+			markers[strconv.Itoa(len(markers))] = definition.Name
+		}
+	}
+	if len(markers) > 0 {
+		inserts[unconstrainedFields] = markers
+	}
+
 	return primary, inserts, nil
 }
 
@@ -362,6 +551,8 @@ type Stringer struct {
 	segmentField    *api.SegmentField
 	lookupField     *api.LookupField
 	fieldDefinition *api.FieldDefinition
+	fieldType       FieldType
+	collation       *Collation
 	iter            func(key, value string) bool
 }
 
@@ -385,7 +576,42 @@ func NewFieldDefinitionStringer(fieldDefinition *api.FieldDefinition) *Stringer
 	}
 }
 
+// withDefinition sets the definition of the field being marshalled, lookups use it to match the encoding of the
+// field index
+func (s *Stringer) withDefinition(fieldDefinition *api.FieldDefinition) *Stringer {
+	s.fieldDefinition = fieldDefinition
+	return s
+}
+
+// withType sets the logical type of the field being marshalled, which is encoded in place of its data type
+func (s *Stringer) withType(fieldType FieldType) *Stringer {
+	s.fieldType = fieldType
+	return s
+}
+
+func (s *Stringer) withCollation(collation *Collation) *Stringer {
+	s.collation = collation
+	return s
+}
+
+// isBlob reports whether string values are written to a BLOB field, which has no lookup value of its own
+func (s *Stringer) isBlob() bool {
+	return s.fieldDefinition.GetDataType() != nil && s.fieldDefinition.GetScalar() == api.ScalarType_DATA_TYPE_BLOB
+}
+
 func (s *Stringer) MarshallText() error {
+	if isTemporalScalar(s.fieldDefinition, s.fieldType) || isTimestampRange(s.fieldDefinition, s.fieldType) {
+		return s.marshallTemporal()
+	}
+
+	if isIPScalar(s.fieldDefinition, s.fieldType) || isCIDRRange(s.fieldDefinition, s.fieldType) {
+		return s.marshallNetwork()
+	}
+
+	if isPathScalar(s.fieldDefinition, s.fieldType) {
+		return s.marshallPath()
+	}
+
 	if s.segmentField != nil {
 		return s.marshallSegment()
 	}
@@ -476,9 +702,17 @@ func (s *Stringer) marshallSegment() error {
 func (s *Stringer) marshallLookup() error {
 	switch s.lookupField.Value.(type) {
 	case *api.LookupField_StringValue:
+		if s.isBlob() {
+			s.fromBlobValue(0, s.lookupField.GetStringValue().Value)
+			break
+		}
 		s.fromStringValue(0, s.lookupField.GetStringValue().Value)
 
 	case *api.LookupField_RepeatedStringValue:
+		if s.isBlob() {
+			s.fromRepeatedBlobValue(s.lookupField.GetRepeatedStringValue().Value)
+			break
+		}
 		s.fromRepeatedStringValue(s.lookupField.GetRepeatedStringValue().Value)
 
 	case *api.LookupField_IntValue:
@@ -553,10 +787,23 @@ func (s *Stringer) unmarshallSegmentFieldText(value string) (segmentField *api.S
 }
 
 func (s *Stringer) unmarshallScalarFieldText(value string) (segmentField *api.SegmentField, err error) {
+	if isTemporalScalar(s.fieldDefinition, s.fieldType) {
+		return s.toTemporalField(value)
+	}
+	if isIPScalar(s.fieldDefinition, s.fieldType) {
+		return s.toIPField(value)
+	}
+	if isPathScalar(s.fieldDefinition, s.fieldType) {
+		return s.toPathField(value)
+	}
+
 	switch s.fieldDefinition.GetScalar() {
-	// STRINGs + BLOBs
-	case api.ScalarType_DATA_TYPE_UNDEFINED, api.ScalarType_DATA_TYPE_STRING, api.ScalarType_DATA_TYPE_BLOB:
+	// STRINGs
+	case api.ScalarType_DATA_TYPE_UNDEFINED, api.ScalarType_DATA_TYPE_STRING:
 		return s.toStringField(value)
+	// BLOBs
+	case api.ScalarType_DATA_TYPE_BLOB:
+		return s.toBlobField(value)
 	// INTs
 	case api.ScalarType_DATA_TYPE_INT, api.ScalarType_DATA_TYPE_INT64, api.ScalarType_DATA_TYPE_INT8,
 		api.ScalarType_DATA_TYPE_INT16, api.ScalarType_DATA_TYPE_INT32:
@@ -577,26 +824,212 @@ func (s *Stringer) unmarshallScalarFieldText(value string) (segmentField *api.Se
 }
 
 func (s *Stringer) unmarshallGeoFieldText(value string) (segmentField *api.SegmentField, err error) {
-	return nil, errors.New("not implemented")
-
-	//switch s.fieldDefinition.GetGeo() {
-	//// RANGEs
-	//case api.GeoType_DATA_TYPE_RANGE, api.GeoType_DATA_TYPE_RANGE_FLOAT:
-	//	return s.toRangeFloatField(value)
-	//case api.GeoType_DATA_TYPE_RANGE_INT:
-	//	return s.toRangeIntField(value)
-	//// GEOs
-	//case api.GeoType_DATA_TYPE_GEO, api.GeoType_DATA_TYPE_GEO_POINT:
-	//	return s.toGeoPointField(value)
-	//case api.GeoType_DATA_TYPE_GEO_RECT:
-	//	return s.toGeoRectField(value)
-	//}
-	//
-	//return nil, ErrFieldUnknown
+	if isCIDRRange(s.fieldDefinition, s.fieldType) {
+		return s.toCIDRField(value)
+	}
+
+	switch s.fieldDefinition.GetGeo() {
+	// RANGEs
+	case api.GeoType_DATA_TYPE_RANGE:
+		// Ints are written without an exponent so a range which parses as ints was written from a RangeIntValue
+		if segmentField, err = s.toRangeIntField(value); err == nil {
+			return segmentField, nil
+		}
+		return s.toRangeFloatField(value)
+	case api.GeoType_DATA_TYPE_RANGE_INT:
+		return s.toRangeIntField(value)
+	case api.GeoType_DATA_TYPE_RANGE_FLOAT:
+		return s.toRangeFloatField(value)
+	// GEOs
+	case api.GeoType_DATA_TYPE_GEO:
+		if points, err2 := parseRect(value); err2 == nil && len(points) == 1 {
+			return s.toGeoPointField(value)
+		}
+		return s.toGeoRectField(value)
+	case api.GeoType_DATA_TYPE_GEO_POINT:
+		return s.toGeoPointField(value)
+	case api.GeoType_DATA_TYPE_GEO_RECT:
+		return s.toGeoRectField(value)
+	}
+
+	return nil, ErrFieldUnknown
+}
+
+// UnmarshallRepeatedText decodes every value written for a field back into a single repeated SegmentField
+func (s *Stringer) UnmarshallRepeatedText(values []string) (*api.SegmentField, error) {
+	if s.fieldDefinition == nil {
+		return nil, errors.New("no field definition was provided")
+	}
+
+	if len(values) == 0 {
+		return nil, errors.New("no values were provided")
+	}
+
+	fields := make([]*api.SegmentField, 0, len(values))
+	for _, value := range values {
+		field, err := s.unmarshallSegmentFieldText(value)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+
+	return repeatSegmentFields(s.fieldDefinition.Name, fields)
+}
+
+// repeatSegmentFields combines single valued SegmentFields of the same type into the repeated equivalent
+func repeatSegmentFields(name string, fields []*api.SegmentField) (*api.SegmentField, error) {
+	repeated := &api.SegmentField{Name: name}
+
+	switch fields[0].Value.(type) {
+	case *api.SegmentField_StringValue:
+		values := make([]string, 0, len(fields))
+		for _, field := range fields {
+			values = append(values, field.GetStringValue().GetValue())
+		}
+		repeated.Value = &api.SegmentField_RepeatedStringValue{
+			RepeatedStringValue: &api.SegmentFieldRepeatedString{Value: values},
+		}
+	case *api.SegmentField_IntValue:
+		values := make([]int64, 0, len(fields))
+		for _, field := range fields {
+			values = append(values, field.GetIntValue().GetValue())
+		}
+		repeated.Value = &api.SegmentField_RepeatedIntValue{
+			RepeatedIntValue: &api.SegmentFieldRepeatedInt{Value: values},
+		}
+	case *api.SegmentField_UintValue:
+		values := make([]uint64, 0, len(fields))
+		for _, field := range fields {
+			values = append(values, field.GetUintValue().GetValue())
+		}
+		repeated.Value = &api.SegmentField_RepeatedUintValue{
+			RepeatedUintValue: &api.SegmentFieldRepeatedUInt{Value: values},
+		}
+	case *api.SegmentField_FloatValue:
+		values := make([]float64, 0, len(fields))
+		for _, field := range fields {
+			values = append(values, field.GetFloatValue().GetValue())
+		}
+		repeated.Value = &api.SegmentField_RepeatedFloatValue{
+			RepeatedFloatValue: &api.SegmentFieldRepeatedFloat{Value: values},
+		}
+	case *api.SegmentField_BoolValue:
+		values := make([]bool, 0, len(fields))
+		for _, field := range fields {
+			values = append(values, field.GetBoolValue().GetValue())
+		}
+		repeated.Value = &api.SegmentField_RepeatedBoolValue{
+			RepeatedBoolValue: &api.SegmentFieldRepeatedBool{Value: values},
+		}
+	case *api.SegmentField_BlobValue:
+		values := make([]string, 0, len(fields))
+		for _, field := range fields {
+			values = append(values, field.GetBlobValue().GetValue())
+		}
+		repeated.Value = &api.SegmentField_RepeatedBlobValue{
+			RepeatedBlobValue: &api.SegmentFieldRepeatedBlob{Value: values},
+		}
+	case *api.SegmentField_RangeIntValue:
+		values := make([]*api.SegmentFieldRangeInt, 0, len(fields))
+		for _, field := range fields {
+			values = append(values, field.GetRangeIntValue())
+		}
+		repeated.Value = &api.SegmentField_RepeatedRangeIntValue{
+			RepeatedRangeIntValue: &api.SegmentFieldRepeatedRangeInt{Value: values},
+		}
+	case *api.SegmentField_RangeFloatValue:
+		values := make([]*api.SegmentFieldRangeFloat, 0, len(fields))
+		for _, field := range fields {
+			values = append(values, field.GetRangeFloatValue())
+		}
+		repeated.Value = &api.SegmentField_RepeatedRangeFloatValue{
+			RepeatedRangeFloatValue: &api.SegmentFieldRepeatedRangeFloat{Value: values},
+		}
+	case *api.SegmentField_GeoPointValue:
+		values := make([]*api.SegmentFieldGeoPoint, 0, len(fields))
+		for _, field := range fields {
+			values = append(values, field.GetGeoPointValue())
+		}
+		repeated.Value = &api.SegmentField_RepeatedGeoPointValue{
+			RepeatedGeoPointValue: &api.SegmentFieldRepeatedGeoPoint{Value: values},
+		}
+	case *api.SegmentField_GeoRectValue:
+		values := make([]*api.SegmentFieldGeoRect, 0, len(fields))
+		for _, field := range fields {
+			values = append(values, field.GetGeoRectValue())
+		}
+		repeated.Value = &api.SegmentField_RepeatedGeoRectValue{
+			RepeatedGeoRectValue: &api.SegmentFieldRepeatedGeoRect{Value: values},
+		}
+	default:
+		return nil, ErrFieldUnknown
+	}
+
+	// Every value must have decoded to the same type
+	for _, field := range fields {
+		if reflect.TypeOf(field.Value) != reflect.TypeOf(fields[0].Value) {
+			return nil, ErrFieldUnknown
+		}
+	}
+
+	return repeated, nil
+}
+
+// parseRect splits the rect encoding used for spatial indexes, e.g. "[1 2],[3 4]", into the coordinates of each point
+func parseRect(value string) ([][]string, error) {
+	return parseRectN(value, 2)
+}
+
+// parseRectN splits a rect with the given number of dimensions into the coordinates of each point
+func parseRectN(value string, dimensions int) ([][]string, error) {
+	points := make([][]string, 0, 2)
+
+	for _, part := range strings.Split(value, "],") {
+		part = strings.TrimSpace(part)
+		part = strings.TrimPrefix(part, "[")
+		part = strings.TrimSuffix(part, "]")
+
+		coordinates := strings.Fields(part)
+		if len(coordinates) != dimensions {
+			return nil, fmt.Errorf("%w: %q is not a valid rect", ErrMarshallingFailed, value)
+		}
+		points = append(points, coordinates)
+	}
+
+	if len(points) > 2 {
+		return nil, fmt.Errorf("%w: %q is not a valid rect", ErrMarshallingFailed, value)
+	}
+
+	return points, nil
+}
+
+// parseRange reads the min and max of a range, which are stored in the second dimension of a rect
+func parseRange(value string) (min string, max string, err error) {
+	points, err := parseRect(value)
+	if err != nil {
+		return "", "", err
+	}
+
+	if len(points) != 2 || points[0][0] != "-inf" || points[1][0] != "+inf" {
+		return "", "", fmt.Errorf("%w: %q is not a valid range", ErrMarshallingFailed, value)
+	}
+
+	return points[0][1], points[1][1], nil
+}
+
+func parseFloatPair(coordinates []string) (x float64, y float64, err error) {
+	if x, err = strconv.ParseFloat(coordinates[0], 64); err != nil {
+		return 0, 0, err
+	}
+	if y, err = strconv.ParseFloat(coordinates[1], 64); err != nil {
+		return 0, 0, err
+	}
+	return x, y, nil
 }
 
 func (s *Stringer) fromStringValue(key int, value string) bool {
-	return s.iter(strconv.Itoa(key), value)
+	return s.iter(strconv.Itoa(key), s.collation.apply(value))
 }
 
 func (s *Stringer) toStringField(value string) (*api.SegmentField, error) {
@@ -731,11 +1164,32 @@ func (s *Stringer) fromRepeatedBoolValue(values []bool) {
 }
 
 func (s *Stringer) fromBlobValue(key int, value string) bool {
-	return s.fromStringValue(key, value)
+	// Blobs are hex encoded, which is safe to use in keys and keeps the byte ordering of the raw value
+	return s.iter(strconv.Itoa(key), hex.EncodeToString([]byte(value)))
+}
+
+func (s *Stringer) toBlobField(value string) (*api.SegmentField, error) {
+	decoded, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.SegmentField{
+		Name: s.fieldDefinition.Name,
+		Value: &api.SegmentField_BlobValue{
+			BlobValue: &api.SegmentFieldBlob{
+				Value: string(decoded),
+			},
+		},
+	}, nil
 }
 
 func (s *Stringer) fromRepeatedBlobValue(values []string) {
-	s.fromRepeatedStringValue(values)
+	for key, value := range values {
+		if ok := s.fromBlobValue(key, value); !ok {
+			break
+		}
+	}
 }
 
 func (s *Stringer) fromRangeIntValue(key int, value *api.SegmentFieldRangeInt) bool {
@@ -744,6 +1198,33 @@ func (s *Stringer) fromRangeIntValue(key int, value *api.SegmentFieldRangeInt) b
 		"[+inf "+strconv.FormatInt(value.Max, 10)+"]")
 }
 
+func (s *Stringer) toRangeIntField(value string) (*api.SegmentField, error) {
+	minText, maxText, err := parseRange(value)
+	if err != nil {
+		return nil, err
+	}
+
+	min, err := strconv.ParseInt(minText, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	max, err := strconv.ParseInt(maxText, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.SegmentField{
+		Name: s.fieldDefinition.Name,
+		Value: &api.SegmentField_RangeIntValue{
+			RangeIntValue: &api.SegmentFieldRangeInt{
+				Min: min,
+				Max: max,
+			},
+		},
+	}, nil
+}
+
 func (s *Stringer) fromRepeatedRangeIntValue(values []*api.SegmentFieldRangeInt) {
 	for key, value := range values {
 		if ok := s.fromRangeIntValue(key, value); !ok {
@@ -758,6 +1239,28 @@ func (s *Stringer) fromRangeFloatValue(key int, value *api.SegmentFieldRangeFloa
 		"[+inf "+strconv.FormatFloat(value.Max, 'E', -1, 64)+"]")
 }
 
+func (s *Stringer) toRangeFloatField(value string) (*api.SegmentField, error) {
+	minText, maxText, err := parseRange(value)
+	if err != nil {
+		return nil, err
+	}
+
+	min, max, err := parseFloatPair([]string{minText, maxText})
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.SegmentField{
+		Name: s.fieldDefinition.Name,
+		Value: &api.SegmentField_RangeFloatValue{
+			RangeFloatValue: &api.SegmentFieldRangeFloat{
+				Min: min,
+				Max: max,
+			},
+		},
+	}, nil
+}
+
 func (s *Stringer) fromRepeatedRangeFloatValue(values []*api.SegmentFieldRangeFloat) {
 	for key, value := range values {
 		if ok := s.fromRangeFloatValue(key, value); !ok {
@@ -771,6 +1274,32 @@ func (s *Stringer) fromGeoPointValue(key int, value *api.SegmentFieldGeoPoint) b
 		strconv.FormatFloat(value.Y, 'E', -1, 64)+"]")
 }
 
+func (s *Stringer) toGeoPointField(value string) (*api.SegmentField, error) {
+	points, err := parseRect(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(points) != 1 {
+		return nil, fmt.Errorf("%w: %q is not a valid point", ErrMarshallingFailed, value)
+	}
+
+	x, y, err := parseFloatPair(points[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.SegmentField{
+		Name: s.fieldDefinition.Name,
+		Value: &api.SegmentField_GeoPointValue{
+			GeoPointValue: &api.SegmentFieldGeoPoint{
+				X: x,
+				Y: y,
+			},
+		},
+	}, nil
+}
+
 func (s *Stringer) fromRepeatedGeoPointValue(values []*api.SegmentFieldGeoPoint) {
 	for key, value := range values {
 		if ok := s.fromGeoPointValue(key, value); !ok {
@@ -789,6 +1318,37 @@ func (s *Stringer) fromGeoRectValue(key int, value *api.SegmentFieldGeoRect) boo
 		strconv.FormatFloat(br.Y, 'E', -1, 64)+"]")
 }
 
+func (s *Stringer) toGeoRectField(value string) (*api.SegmentField, error) {
+	points, err := parseRect(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(points) != 2 {
+		return nil, fmt.Errorf("%w: %q is not a valid rect", ErrMarshallingFailed, value)
+	}
+
+	tlX, tlY, err := parseFloatPair(points[0])
+	if err != nil {
+		return nil, err
+	}
+
+	brX, brY, err := parseFloatPair(points[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.SegmentField{
+		Name: s.fieldDefinition.Name,
+		Value: &api.SegmentField_GeoRectValue{
+			GeoRectValue: &api.SegmentFieldGeoRect{
+				TopLeft:     &api.SegmentFieldGeoPoint{X: tlX, Y: tlY},
+				BottomRight: &api.SegmentFieldGeoPoint{X: brX, Y: brY},
+			},
+		},
+	}, nil
+}
+
 func (s *Stringer) fromRepeatedGeoRectValue(values []*api.SegmentFieldGeoRect) {
 	for key, value := range values {
 		if ok := s.fromGeoRectValue(key, value); !ok {
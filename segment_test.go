@@ -3,10 +3,12 @@ package db
 import (
 	"context"
 	"fmt"
+	"github.com/golang/protobuf/proto"
 	api "github.com/segmentq/protos-api-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/tidwall/buntdb"
 	"testing"
+	"testing/quick"
 )
 
 func testSingleFieldIndex(t *testing.T, db *DB, name string) *Index {
@@ -900,7 +902,26 @@ func TestStringer_fromBlobValue(t *testing.T) {
 		args   args
 		want   bool
 	}{
-		// TODO: Add test cases.
+		{
+			name: "colon and invalid utf-8 are hex encoded",
+			fields: fields{
+				iter: func(key, value string) bool {
+					return key == "0" && value == "613aff00"
+				},
+			},
+			args: args{key: 0, value: "a:\xff\x00"},
+			want: true,
+		},
+		{
+			name: "empty blob",
+			fields: fields{
+				iter: func(key, value string) bool {
+					return key == "1" && value == ""
+				},
+			},
+			args: args{key: 1, value: ""},
+			want: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -1688,3 +1709,245 @@ func TestDB_GetAllSegments(t *testing.T) {
 		})
 	}
 }
+
+// testStringerRoundTrip encodes a field with a segment Stringer and decodes it again with a field definition Stringer
+func testStringerRoundTrip(t *testing.T, definition *api.FieldDefinition, field *api.SegmentField) bool {
+	values := make([]string, 0)
+	stringer := NewSegmentStringer(field, func(key, value string) bool {
+		values = append(values, value)
+		return true
+	})
+
+	if err := stringer.MarshallText(); err != nil {
+		t.Log(err)
+		return false
+	}
+
+	var got *api.SegmentField
+	var err error
+	if isRepeatedSegmentField(field) {
+		got, err = NewFieldDefinitionStringer(definition).UnmarshallRepeatedText(values)
+	} else {
+		got, err = NewFieldDefinitionStringer(definition).UnmarshallText(values[0])
+	}
+
+	if err != nil {
+		t.Log(err)
+		return false
+	}
+
+	if !proto.Equal(field, got) {
+		t.Logf("encoded %v, decoded %v", field, got)
+		return false
+	}
+
+	return true
+}
+
+func TestStringer_RoundTrip(t *testing.T) {
+	scalar := func(scalarType api.ScalarType) *api.FieldDefinition {
+		return &api.FieldDefinition{Name: "field", DataType: &api.FieldDefinition_Scalar{Scalar: scalarType}}
+	}
+	geo := func(geoType api.GeoType) *api.FieldDefinition {
+		return &api.FieldDefinition{Name: "field", DataType: &api.FieldDefinition_Geo{Geo: geoType}}
+	}
+	rangeInts := func(mins, maxs []int64) []*api.SegmentFieldRangeInt {
+		values := make([]*api.SegmentFieldRangeInt, 0, len(mins))
+		for n := range mins {
+			if n < len(maxs) {
+				values = append(values, &api.SegmentFieldRangeInt{Min: mins[n], Max: maxs[n]})
+			}
+		}
+		return values
+	}
+	rangeFloats := func(mins, maxs []float64) []*api.SegmentFieldRangeFloat {
+		values := make([]*api.SegmentFieldRangeFloat, 0, len(mins))
+		for n := range mins {
+			if n < len(maxs) {
+				values = append(values, &api.SegmentFieldRangeFloat{Min: mins[n], Max: maxs[n]})
+			}
+		}
+		return values
+	}
+	points := func(xs, ys []float64) []*api.SegmentFieldGeoPoint {
+		values := make([]*api.SegmentFieldGeoPoint, 0, len(xs))
+		for n := range xs {
+			if n < len(ys) {
+				values = append(values, &api.SegmentFieldGeoPoint{X: xs[n], Y: ys[n]})
+			}
+		}
+		return values
+	}
+	rects := func(xs, ys []float64) []*api.SegmentFieldGeoRect {
+		values := make([]*api.SegmentFieldGeoRect, 0, len(xs))
+		for n := 1; n < len(xs) && n < len(ys); n += 2 {
+			values = append(values, &api.SegmentFieldGeoRect{
+				TopLeft:     &api.SegmentFieldGeoPoint{X: xs[n-1], Y: ys[n-1]},
+				BottomRight: &api.SegmentFieldGeoPoint{X: xs[n], Y: ys[n]},
+			})
+		}
+		return values
+	}
+
+	tests := []struct {
+		name     string
+		property interface{}
+	}{
+		{
+			name: "string",
+			property: func(v string) bool {
+				return testStringerRoundTrip(t, scalar(api.ScalarType_DATA_TYPE_STRING),
+					&api.SegmentField{Name: "field", Value: &api.SegmentField_StringValue{StringValue: &api.SegmentFieldString{Value: v}}})
+			},
+		},
+		{
+			name: "repeated string",
+			property: func(v []string) bool {
+				return len(v) == 0 || testStringerRoundTrip(t, scalar(api.ScalarType_DATA_TYPE_STRING),
+					&api.SegmentField{Name: "field", Value: &api.SegmentField_RepeatedStringValue{RepeatedStringValue: &api.SegmentFieldRepeatedString{Value: v}}})
+			},
+		},
+		{
+			name: "int",
+			property: func(v int64) bool {
+				return testStringerRoundTrip(t, scalar(api.ScalarType_DATA_TYPE_INT64),
+					&api.SegmentField{Name: "field", Value: &api.SegmentField_IntValue{IntValue: &api.SegmentFieldInt{Value: v}}})
+			},
+		},
+		{
+			name: "repeated int",
+			property: func(v []int64) bool {
+				return len(v) == 0 || testStringerRoundTrip(t, scalar(api.ScalarType_DATA_TYPE_INT64),
+					&api.SegmentField{Name: "field", Value: &api.SegmentField_RepeatedIntValue{RepeatedIntValue: &api.SegmentFieldRepeatedInt{Value: v}}})
+			},
+		},
+		{
+			name: "uint",
+			property: func(v uint64) bool {
+				return testStringerRoundTrip(t, scalar(api.ScalarType_DATA_TYPE_UINT64),
+					&api.SegmentField{Name: "field", Value: &api.SegmentField_UintValue{UintValue: &api.SegmentFieldUInt{Value: v}}})
+			},
+		},
+		{
+			name: "repeated uint",
+			property: func(v []uint64) bool {
+				return len(v) == 0 || testStringerRoundTrip(t, scalar(api.ScalarType_DATA_TYPE_UINT64),
+					&api.SegmentField{Name: "field", Value: &api.SegmentField_RepeatedUintValue{RepeatedUintValue: &api.SegmentFieldRepeatedUInt{Value: v}}})
+			},
+		},
+		{
+			name: "float",
+			property: func(v float64) bool {
+				return testStringerRoundTrip(t, scalar(api.ScalarType_DATA_TYPE_FLOAT64),
+					&api.SegmentField{Name: "field", Value: &api.SegmentField_FloatValue{FloatValue: &api.SegmentFieldFloat{Value: v}}})
+			},
+		},
+		{
+			name: "repeated float",
+			property: func(v []float64) bool {
+				return len(v) == 0 || testStringerRoundTrip(t, scalar(api.ScalarType_DATA_TYPE_FLOAT64),
+					&api.SegmentField{Name: "field", Value: &api.SegmentField_RepeatedFloatValue{RepeatedFloatValue: &api.SegmentFieldRepeatedFloat{Value: v}}})
+			},
+		},
+		{
+			name: "bool",
+			property: func(v bool) bool {
+				return testStringerRoundTrip(t, scalar(api.ScalarType_DATA_TYPE_BOOL),
+					&api.SegmentField{Name: "field", Value: &api.SegmentField_BoolValue{BoolValue: &api.SegmentFieldBool{Value: v}}})
+			},
+		},
+		{
+			name: "repeated bool",
+			property: func(v []bool) bool {
+				return len(v) == 0 || testStringerRoundTrip(t, scalar(api.ScalarType_DATA_TYPE_BOOL),
+					&api.SegmentField{Name: "field", Value: &api.SegmentField_RepeatedBoolValue{RepeatedBoolValue: &api.SegmentFieldRepeatedBool{Value: v}}})
+			},
+		},
+		{
+			name: "blob",
+			property: func(v string) bool {
+				return testStringerRoundTrip(t, scalar(api.ScalarType_DATA_TYPE_BLOB),
+					&api.SegmentField{Name: "field", Value: &api.SegmentField_BlobValue{BlobValue: &api.SegmentFieldBlob{Value: v}}})
+			},
+		},
+		{
+			name: "repeated blob",
+			property: func(v []string) bool {
+				return len(v) == 0 || testStringerRoundTrip(t, scalar(api.ScalarType_DATA_TYPE_BLOB),
+					&api.SegmentField{Name: "field", Value: &api.SegmentField_RepeatedBlobValue{RepeatedBlobValue: &api.SegmentFieldRepeatedBlob{Value: v}}})
+			},
+		},
+		{
+			name: "range int",
+			property: func(min, max int64) bool {
+				value := &api.SegmentField{Name: "field", Value: &api.SegmentField_RangeIntValue{RangeIntValue: &api.SegmentFieldRangeInt{Min: min, Max: max}}}
+				return testStringerRoundTrip(t, geo(api.GeoType_DATA_TYPE_RANGE_INT), value) &&
+					testStringerRoundTrip(t, geo(api.GeoType_DATA_TYPE_RANGE), value)
+			},
+		},
+		{
+			name: "repeated range int",
+			property: func(mins, maxs []int64) bool {
+				values := rangeInts(mins, maxs)
+				return len(values) == 0 || testStringerRoundTrip(t, geo(api.GeoType_DATA_TYPE_RANGE_INT),
+					&api.SegmentField{Name: "field", Value: &api.SegmentField_RepeatedRangeIntValue{RepeatedRangeIntValue: &api.SegmentFieldRepeatedRangeInt{Value: values}}})
+			},
+		},
+		{
+			name: "range float",
+			property: func(min, max float64) bool {
+				value := &api.SegmentField{Name: "field", Value: &api.SegmentField_RangeFloatValue{RangeFloatValue: &api.SegmentFieldRangeFloat{Min: min, Max: max}}}
+				return testStringerRoundTrip(t, geo(api.GeoType_DATA_TYPE_RANGE_FLOAT), value) &&
+					testStringerRoundTrip(t, geo(api.GeoType_DATA_TYPE_RANGE), value)
+			},
+		},
+		{
+			name: "repeated range float",
+			property: func(mins, maxs []float64) bool {
+				values := rangeFloats(mins, maxs)
+				return len(values) == 0 || testStringerRoundTrip(t, geo(api.GeoType_DATA_TYPE_RANGE_FLOAT),
+					&api.SegmentField{Name: "field", Value: &api.SegmentField_RepeatedRangeFloatValue{RepeatedRangeFloatValue: &api.SegmentFieldRepeatedRangeFloat{Value: values}}})
+			},
+		},
+		{
+			name: "geo point",
+			property: func(x, y float64) bool {
+				value := &api.SegmentField{Name: "field", Value: &api.SegmentField_GeoPointValue{GeoPointValue: &api.SegmentFieldGeoPoint{X: x, Y: y}}}
+				return testStringerRoundTrip(t, geo(api.GeoType_DATA_TYPE_GEO_POINT), value) &&
+					testStringerRoundTrip(t, geo(api.GeoType_DATA_TYPE_GEO), value)
+			},
+		},
+		{
+			name: "repeated geo point",
+			property: func(xs, ys []float64) bool {
+				values := points(xs, ys)
+				return len(values) == 0 || testStringerRoundTrip(t, geo(api.GeoType_DATA_TYPE_GEO_POINT),
+					&api.SegmentField{Name: "field", Value: &api.SegmentField_RepeatedGeoPointValue{RepeatedGeoPointValue: &api.SegmentFieldRepeatedGeoPoint{Value: values}}})
+			},
+		},
+		{
+			name: "geo rect",
+			property: func(x1, y1, x2, y2 float64) bool {
+				value := &api.SegmentField{Name: "field", Value: &api.SegmentField_GeoRectValue{GeoRectValue: &api.SegmentFieldGeoRect{
+					TopLeft:     &api.SegmentFieldGeoPoint{X: x1, Y: y1},
+					BottomRight: &api.SegmentFieldGeoPoint{X: x2, Y: y2},
+				}}}
+				return testStringerRoundTrip(t, geo(api.GeoType_DATA_TYPE_GEO_RECT), value) &&
+					testStringerRoundTrip(t, geo(api.GeoType_DATA_TYPE_GEO), value)
+			},
+		},
+		{
+			name: "repeated geo rect",
+			property: func(xs, ys []float64) bool {
+				values := rects(xs, ys)
+				return len(values) == 0 || testStringerRoundTrip(t, geo(api.GeoType_DATA_TYPE_GEO_RECT),
+					&api.SegmentField{Name: "field", Value: &api.SegmentField_RepeatedGeoRectValue{RepeatedGeoRectValue: &api.SegmentFieldRepeatedGeoRect{Value: values}}})
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, quick.Check(tt.property, nil))
+		})
+	}
+}
@@ -0,0 +1,345 @@
+package db
+
+import (
+	"fmt"
+	api "github.com/segmentq/protos-api-go"
+	"github.com/tidwall/buntdb"
+	"strconv"
+)
+
+// WithSort orders results by the values of a field, or by the primary key when the field is empty. Segments with
+// equal values are ordered by key in the same direction and segments which omit the field come last. A segment
+// holding several values is ordered by its least, or when descending its greatest.
+func WithSort(field string, descending bool) LookupOption {
+	return func(l *Lookup) {
+		l.sorted = true
+		l.sortField = field
+		l.descending = descending
+	}
+}
+
+// entry is a lookup result with the value it is sorted by
+type entry struct {
+	key     string
+	value   string
+	missing bool
+}
+
+// order compares lookup results, by the field index values they are sorted by and then by key
+type order struct {
+	field      string
+	less       func(a, b string) bool
+	descending bool
+
+	// score returns the entry of a segment when results are ordered by score rather than a field
+	score func(e *evaluator, key string) (entry, error)
+}
+
+// keyOrder orders results by key alone, as pages of unsorted lookups and listings are
+var keyOrder = &order{}
+
+// before reports whether entry a is returned before entry b
+func (o *order) before(a, b entry) bool {
+	if o.less != nil {
+		if a.missing != b.missing {
+			return b.missing
+		}
+		if !a.missing {
+			if o.less(a.value, b.value) {
+				return !o.descending
+			}
+			if o.less(b.value, a.value) {
+				return o.descending
+			}
+		}
+	}
+
+	// Equal values are ordered as the engine orders the keys of a field index, which are separated from the value
+	// position that follows them
+	ka, kb := a.key, b.key
+	if o.less != nil {
+		ka, kb = ka+idxSep, kb+idxSep
+	}
+
+	if o.descending {
+		return ka > kb
+	}
+	return ka < kb
+}
+
+// first returns the position of the value a segment is sorted by, the least or when descending the greatest
+func (o *order) first(values []string) (int, bool) {
+	if len(values) == 0 {
+		return 0, false
+	}
+
+	n := 0
+	for m, value := range values[1:] {
+		if o.descending && o.less(values[n], value) || !o.descending && o.less(value, values[n]) {
+			n = m + 1
+		}
+	}
+	return n, true
+}
+
+// newOrder checks the field a lookup is sorted by, which must be an indexed scalar
+func (l *Lookup) newOrder(indexName string) (*order, error) {
+	if !l.sorted {
+		return keyOrder, nil
+	}
+
+	return l.fieldOrder(indexName, l.sortField, l.descending)
+}
+
+// fieldOrder orders results by the values of a field, or of the primary field when the name is empty
+func (l *Lookup) fieldOrder(indexName string, name string, descending bool) (*order, error) {
+	if name == "" {
+		for _, definition := range l.db.fields[indexName] {
+			if definition.IsPrimary {
+				name = definition.Name
+			}
+		}
+	}
+
+	definition, ok := l.db.fields[indexName][name]
+	if !ok {
+		return nil, ErrFieldUnknown
+	}
+
+	options := l.db.options[indexName][name]
+	if !options.indexed() {
+		return nil, fmt.Errorf("%w: %s", ErrFieldNotIndexed, name)
+	}
+
+	less, ok := scalarLess(definition, options.fieldType())
+	_, scalar := definition.GetDataType().(*api.FieldDefinition_Scalar)
+	if !ok || !scalar || isSpatialField(definition, options.fieldType()) {
+		return nil, fmt.Errorf("%w: %s is %s", ErrInvalidSort, name, fieldTypeName(definition, options.fieldType()))
+	}
+
+	return &order{field: name, less: less, descending: descending}, nil
+}
+
+// entry reads the value a segment is sorted by
+func (o *order) entry(e *evaluator, key string) (entry, error) {
+	if o.less == nil {
+		return entry{key: key}, nil
+	}
+	if o.score != nil {
+		return o.score(e, key)
+	}
+
+	values, err := readValues(e.tx, e.indexId, o.field, key)
+	if err != nil {
+		return entry{}, err
+	}
+
+	result, _ := o.entryOf(key, values)
+	return result, nil
+}
+
+// entryOf returns the entry of a segment holding the values, with the position of the value it is sorted by
+func (o *order) entryOf(key string, values []string) (entry, int) {
+	n, ok := o.first(values)
+	if !ok {
+		return entry{key: key, missing: true}, -1
+	}
+	return entry{key: key, value: values[n]}, n
+}
+
+// streamOrdered sends the results of a sorted or paged lookup. Matches are either found by scanning the index of
+// the sort field in order, which returns the first results without finding every match, or collected and sorted,
+// whichever the field statistics suggest is cheaper.
+func (t *Iterator) streamOrdered(e *evaluator, query Query, p *page,
+	send func(result entry, cursor string) bool) error {
+	// Offset results are found as part of the page and skipped, only the last result of the page returns a cursor
+	if p.offset > 0 {
+		skip, deliver := p.offset, send
+		send = func(result entry, cursor string) bool {
+			if skip > 0 {
+				skip--
+				return true
+			}
+			return deliver(result, cursor)
+		}
+
+		offset := *p
+		offset.offset = 0
+		if offset.limit > 0 {
+			offset.limit += p.offset
+		}
+		p = &offset
+	}
+
+	if p.order.less != nil && p.order.score == nil {
+		stats, err := readFieldStats(e.tx, e.indexId, p.order.field)
+		if err != nil {
+			return err
+		}
+
+		matches, entries := float64(query.cost(e)), float64(stats.Entries)
+		if p.limit > 0 && float64(p.limit)*entries < matches*matches || p.limit <= 0 && entries <= matches {
+			return t.streamIndexOrder(e, query, p, send)
+		}
+	}
+
+	entries := &pageEntries{p: p}
+	if err := t.collect(e, query, p, entries.add); err != nil {
+		return err
+	}
+
+	results, cursor := entries.page()
+	for n, result := range results {
+		next := ""
+		if n == len(results)-1 {
+			next = cursor
+		}
+		if !send(result, next) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// collect passes each match of the query on the page to add, with the value it is sorted by
+func (t *Iterator) collect(e *evaluator, query Query, p *page, add func(e entry)) error {
+	var collectErr error
+	err := query.candidates(e, func(key string) bool {
+		result, err := p.order.entry(e, key)
+		if err != nil {
+			collectErr = err
+			return false
+		}
+		if !p.includes(result) {
+			return true
+		}
+
+		ok, err := query.test(e, key)
+		if err != nil {
+			collectErr = err
+			return false
+		}
+		if ok {
+			add(result)
+		}
+		return true
+	})
+
+	if err != nil {
+		return err
+	}
+	return collectErr
+}
+
+// streamIndexOrder sends matches as the index of the sort field is scanned in order, followed by the matches which
+// omit the field
+func (t *Iterator) streamIndexOrder(e *evaluator, query Query, p *page,
+	send func(result entry, cursor string) bool) error {
+	o := p.order
+	sent := 0
+	stopped := false
+
+	// The last match is held until the next is found, so the cursor is only returned when another page follows
+	var held *entry
+	emit := func(result entry) bool {
+		if held != nil {
+			if p.full(sent + 1) {
+				send(*held, p.cursor(*held))
+				stopped = true
+				return false
+			}
+			if !send(*held, "") {
+				stopped = true
+				return false
+			}
+			sent++
+		}
+		held = &result
+		return true
+	}
+
+	var visitErr error
+	visit := func(key, value string) bool {
+		keyObject := keyFromString(key)
+		k, ok := keyObject.SegmentKey()
+		if !ok {
+			return true
+		}
+		index, _ := keyObject.FieldValueIndex()
+
+		// A segment holding several values is visited once for each, it is sent with the value it is sorted by
+		values, err := readValues(e.tx, e.indexId, o.field, k)
+		if err != nil {
+			visitErr = err
+			return false
+		}
+		result, n := o.entryOf(k, values)
+		if strconv.Itoa(n) != index || !p.includes(result) {
+			return true
+		}
+
+		matched, err := query.test(e, k)
+		if err != nil {
+			visitErr = err
+			return false
+		}
+		if !matched {
+			return true
+		}
+		return emit(result)
+	}
+
+	index := idxKey(e.indexId, o.field)
+	var err error
+	switch {
+	case p.after != nil && p.after.missing:
+		// The cursor is past every segment holding the field
+	case p.after != nil && o.descending:
+		err = e.tx.DescendLessOrEqual(index, p.after.value, visit)
+	case p.after != nil:
+		err = e.tx.AscendGreaterOrEqual(index, p.after.value, visit)
+	case o.descending:
+		err = e.tx.Descend(index, visit)
+	default:
+		err = e.tx.Ascend(index, visit)
+	}
+	if err != nil && err != buntdb.ErrNotFound {
+		return ErrLookupFailure
+	}
+	if visitErr != nil || stopped {
+		return visitErr
+	}
+
+	// Segments which omit the field are ordered by key, only as many as fill the page and tell whether another
+	// follows are held
+	remaining := &page{after: p.after, scope: p.scope, order: o}
+	if p.limit > 0 {
+		remaining.limit = p.limit - sent
+		if held != nil {
+			remaining.limit--
+		}
+		if remaining.limit < 1 {
+			remaining.limit = 1
+		}
+	}
+	missing := &pageEntries{p: remaining}
+	err = t.collect(e, query, remaining, func(result entry) {
+		if result.missing {
+			missing.add(result)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, result := range missing.entries {
+		if !emit(result) {
+			return nil
+		}
+	}
+
+	if held != nil {
+		send(*held, "")
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package db
+
+import (
+	"fmt"
+	api "github.com/segmentq/protos-api-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func testPriorityIndex(t *testing.T, db *DB, count int) *Index {
+	index, err := db.CreateIndex(&api.IndexDefinition{
+		Name: "priorities",
+		Fields: []*api.FieldDefinition{
+			{
+				Name:      "name",
+				DataType:  &api.FieldDefinition_Scalar{Scalar: api.ScalarType_DATA_TYPE_STRING},
+				IsPrimary: true,
+			},
+			scalarField("active", api.ScalarType_DATA_TYPE_BOOL),
+			scalarField("priority", api.ScalarType_DATA_TYPE_INT),
+			{
+				Name:     "area",
+				DataType: &api.FieldDefinition_Geo{Geo: api.GeoType_DATA_TYPE_GEO_RECT},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Priorities repeat every 5 segments, and every 7th segment has none
+	for n := 0; n < count; n++ {
+		segment := getSingleFieldSegment(fmt.Sprintf("segment-%02d", n))
+		segment.Fields = append(segment.Fields, &api.SegmentField{
+			Name:  "active",
+			Value: &api.SegmentField_BoolValue{BoolValue: &api.SegmentFieldBool{Value: n != 3}},
+		})
+		if n%7 != 6 {
+			segment.Fields = append(segment.Fields, intSegmentField("priority", int64(n%5)))
+		}
+		if _, err = index.InsertSegment(segment); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return index
+}
+
+// testSortedKeys returns the keys of the priority index in the order they are sorted by
+func testSortedKeys(count int, descending bool) []string {
+	keys := make([]string, 0, count)
+	missing := make([]string, 0)
+
+	priorities := []int{0, 1, 2, 3, 4}
+	if descending {
+		priorities = []int{4, 3, 2, 1, 0}
+	}
+
+	for _, priority := range priorities {
+		for n := 0; n < count; n++ {
+			m := n
+			if descending {
+				m = count - 1 - n
+			}
+			if m == 3 || m%7 == 6 || m%5 != priority {
+				continue
+			}
+			keys = append(keys, fmt.Sprintf("segment-%02d", m))
+		}
+	}
+
+	for n := 0; n < count; n++ {
+		m := n
+		if descending {
+			m = count - 1 - n
+		}
+		if m != 3 && m%7 == 6 {
+			missing = append(missing, fmt.Sprintf("segment-%02d", m))
+		}
+	}
+
+	return append(keys, missing...)
+}
+
+func TestIndex_Lookup_WithSort(t *testing.T) {
+	d := testNewDB(t)
+	index := testPriorityIndex(t, d, 30)
+	active := &api.Lookup{Fields: []*api.LookupField{boolLookupField("active", true)}}
+
+	tests := []struct {
+		name       string
+		descending bool
+		limit      int
+	}{
+		{name: "ascending"},
+		{name: "descending", descending: true},
+		{name: "ascending pages", limit: 4},
+		{name: "descending pages", descending: true, limit: 4},
+		{name: "pages of one", descending: true, limit: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := make([]string, 0)
+			cursor := ""
+
+			for {
+				opts := []LookupOption{WithSort("priority", tt.descending)}
+				if tt.limit > 0 {
+					opts = append(opts, WithPage(tt.limit, cursor))
+				}
+
+				it, err := index.Lookup(active, opts...)
+				if !assert.NoError(t, err) {
+					return
+				}
+				keys = append(keys, testCollectKeys(t, it)...)
+
+				if cursor = it.Cursor(); cursor == "" {
+					break
+				}
+			}
+
+			assert.Equal(t, testSortedKeys(30, tt.descending), keys)
+		})
+	}
+}
+
+func TestIndex_Lookup_WithSort_Selective(t *testing.T) {
+	d := testNewDB(t)
+	index := testPriorityIndex(t, d, 30)
+
+	// Few matches are collected and sorted rather than found by scanning the sort field
+	lookup := &api.Lookup{
+		Fields: []*api.LookupField{
+			{
+				Name: "name",
+				Value: &api.LookupField_RepeatedStringValue{
+					RepeatedStringValue: &api.SegmentFieldRepeatedString{
+						Value: []string{"segment-01", "segment-06", "segment-09", "segment-13", "segment-14"},
+					},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		field      string
+		descending bool
+		want       []string
+	}{
+		{
+			name:       "by field descending",
+			field:      "priority",
+			descending: true,
+			want:       []string{"segment-14", "segment-09", "segment-01", "segment-13", "segment-06"},
+		},
+		{
+			name:  "by primary key",
+			want:  []string{"segment-01", "segment-06", "segment-09", "segment-13", "segment-14"},
+			field: "",
+		},
+		{
+			name:       "by primary key descending",
+			descending: true,
+			want:       []string{"segment-14", "segment-13", "segment-09", "segment-06", "segment-01"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it, err := index.Lookup(lookup, WithSort(tt.field, tt.descending))
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.want, testCollectKeys(t, it))
+		})
+	}
+}
+
+func TestIndex_LookupSegments_WithSort(t *testing.T) {
+	d := testNewDB(t)
+	index := testPriorityIndex(t, d, 30)
+
+	it, err := index.LookupSegments(&api.Lookup{Fields: []*api.LookupField{boolLookupField("active", true)}},
+		WithSort("priority", true), WithPage(1, ""))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	segment := &api.Segment{}
+	key, err := it.Next(segment)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "segment-29", key)
+
+	for _, field := range segment.GetFields() {
+		if field.Name == "priority" {
+			assert.Equal(t, int64(4), field.GetIntValue().GetValue())
+		}
+	}
+	it.Close()
+}
+
+func TestIndex_Lookup_WithSort_Invalid(t *testing.T) {
+	d := testNewDB(t)
+	index := testPriorityIndex(t, d, 1)
+	lookup := &api.Lookup{Fields: []*api.LookupField{boolLookupField("active", true)}}
+
+	_, err := index.Lookup(lookup, WithSort("rank", false))
+	assert.ErrorIs(t, err, ErrFieldUnknown)
+
+	_, err = index.Lookup(lookup, WithSort("area", false))
+	assert.ErrorIs(t, err, ErrInvalidSort)
+
+	// A cursor of an unsorted lookup cannot resume a sorted one
+	it, err := index.Lookup(lookup, WithPage(1, ""))
+	if !assert.NoError(t, err) {
+		return
+	}
+	testCollectKeys(t, it)
+	_, err = index.Lookup(lookup, WithPage(1, it.Cursor()), WithSort("priority", false))
+	if it.Cursor() != "" {
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	}
+}
@@ -0,0 +1,148 @@
+package db
+
+import (
+	"encoding/json"
+	api "github.com/segmentq/protos-api-go"
+	"github.com/tidwall/buntdb"
+	"strconv"
+)
+
+// FieldStats describes the values held by a field index, the lookup planner uses them to scan selective fields first
+type FieldStats struct {
+	// Entries is the number of values in the field index, a repeated field holds one per value
+	Entries int64 `json:"entries"`
+
+	// Distinct is the number of different values in the field index
+	Distinct int64 `json:"distinct"`
+}
+
+// FieldStats returns the statistics of the named field
+func (i *Index) FieldStats(name string) (*FieldStats, error) {
+	if _, ok := i.db.fields[i.definition.Name][name]; !ok {
+		return nil, ErrFieldUnknown
+	}
+
+	var stats *FieldStats
+	err := i.db.engine.View(func(tx *buntdb.Tx) error {
+		idx, err := tx.Get(idxKey(idxById, i.definition.Name), true)
+		if err != nil {
+			return ErrInternalDBError
+		}
+
+		stats, err = readFieldStats(tx, idx, name)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// readFieldStats reads the statistics of a field index, which are kept with the segments so Truncate clears them
+func readFieldStats(tx *buntdb.Tx, idx string, field string) (*FieldStats, error) {
+	stats := &FieldStats{}
+
+	encoded, err := tx.Get(idxKey(idx, fieldStatsByIdx, field), true)
+	if err == buntdb.ErrNotFound {
+		return stats, nil
+	}
+	if err != nil {
+		return nil, ErrInternalDBError
+	}
+
+	if err = json.Unmarshal([]byte(encoded), stats); err != nil {
+		return nil, ErrMarshallingFailed
+	}
+
+	return stats, nil
+}
+
+// foldedFields returns the fields whose index compares values without case, so their values are counted that way
+func foldedFields(fields []*api.FieldDefinition, options map[string]*FieldOptions) map[string]bool {
+	folded := make(map[string]bool)
+	for _, definition := range fields {
+		if foldsCase(definition, options[definition.Name].fieldType()) {
+			folded[definition.Name] = true
+		}
+	}
+	return folded
+}
+
+// countedValue returns the value an encoded value is counted as, values which differ only in case are counted as
+// one by a field index which compares them without case
+func countedValue(value string, fold bool) string {
+	if fold {
+		return lowerASCII(value)
+	}
+	return value
+}
+
+// readValueCount returns how many times a counted value is held in a field index
+func readValueCount(tx *buntdb.Tx, idx string, field string, value string) (int64, error) {
+	encoded, err := tx.Get(idxKey(idx, fieldStatsByIdx, field, value), true)
+	if err == buntdb.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, ErrInternalDBError
+	}
+
+	count, err := strconv.ParseInt(encoded, 10, 64)
+	if err != nil {
+		return 0, ErrMarshallingFailed
+	}
+
+	return count, nil
+}
+
+// updateStats counts the values written to (delta 1) or deleted from (delta -1) each field index
+func updateStats(tx *buntdb.Tx, idx string, valueMap map[string]map[string]string, folded map[string]bool,
+	delta int64) error {
+	for field, values := range valueMap {
+		stats, err := readFieldStats(tx, idx, field)
+		if err != nil {
+			return err
+		}
+
+		for _, value := range values {
+			value = countedValue(value, folded[field])
+			count, err := readValueCount(tx, idx, field, value)
+			if err != nil {
+				return err
+			}
+
+			stats.Entries += delta
+			switch {
+			case count == 0 && delta > 0:
+				stats.Distinct++
+			case count+delta <= 0 && count > 0:
+				stats.Distinct--
+			}
+
+			key := idxKey(idx, fieldStatsByIdx, field, value)
+			if count+delta <= 0 {
+				if _, err = tx.Delete(key); err != nil && err != buntdb.ErrNotFound {
+					return ErrInternalDBError
+				}
+				continue
+			}
+
+			if _, _, err = tx.Set(key, strconv.FormatInt(count+delta, 10), nil); err != nil {
+				return ErrInternalDBError
+			}
+		}
+
+		encoded, err := json.Marshal(stats)
+		if err != nil {
+			return ErrMarshallingFailed
+		}
+
+		if _, _, err = tx.Set(idxKey(idx, fieldStatsByIdx, field), string(encoded), nil); err != nil {
+			return ErrInternalDBError
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,262 @@
+package db
+
+import (
+	"fmt"
+	api "github.com/segmentq/protos-api-go"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Temporal field types are set in the FieldOptions of INT64 and RANGE_INT fields
+const (
+	// FieldTypeTimestamp INT64 fields take an IntValue of unix seconds or an RFC 3339 StringValue. RANGE_INT fields
+	// take a RangeIntValue of unix seconds, e.g. the flight dates of a campaign.
+	FieldTypeTimestamp FieldType = "timestamp"
+	// FieldTypeDate INT64 fields take an IntValue of unix seconds or a "2006-01-02" StringValue, truncated to the day
+	// in UTC
+	FieldTypeDate FieldType = "date"
+)
+
+const dateLayout = "2006-01-02"
+
+// minTemporal and maxTemporal bound the times which unix nanoseconds can hold
+var (
+	minTemporal = time.Unix(0, math.MinInt64).UTC()
+	maxTemporal = time.Unix(0, math.MaxInt64).UTC()
+)
+
+// isTemporalScalar reports whether the field is a timestamp or a date
+func isTemporalScalar(definition *api.FieldDefinition, fieldType FieldType) bool {
+	_, ok := definition.GetDataType().(*api.FieldDefinition_Scalar)
+	return ok && (fieldType == FieldTypeTimestamp || fieldType == FieldTypeDate)
+}
+
+// isTimestampRange reports whether the field is a range of timestamps
+func isTimestampRange(definition *api.FieldDefinition, fieldType FieldType) bool {
+	_, ok := definition.GetDataType().(*api.FieldDefinition_Geo)
+	return ok && fieldType == FieldTypeTimestamp
+}
+
+// parseTemporal reads an RFC 3339 timestamp, or a date when the field is a date
+func parseTemporal(definition *api.FieldDefinition, fieldType FieldType, value string) (time.Time, error) {
+	if fieldType == FieldTypeDate {
+		if t, err := time.Parse(dateLayout, value); err == nil {
+			return t, nil
+		}
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: field %q cannot parse %q as a time", ErrTypeMismatch, definition.Name, value)
+	}
+	return t, nil
+}
+
+// unixTemporal converts unix seconds into a time, seconds beyond those unix nanoseconds can hold are out of range
+func unixTemporal(definition *api.FieldDefinition, seconds int64) (time.Time, error) {
+	if seconds < minTemporal.Unix() || seconds > maxTemporal.Unix() {
+		return time.Time{}, outOfRange(definition, seconds)
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+// temporalNanos converts a time into the sortable unix nanoseconds stored in the field index
+func temporalNanos(definition *api.FieldDefinition, fieldType FieldType, t time.Time) (int64, error) {
+	t = t.UTC()
+	if fieldType == FieldTypeDate {
+		t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+
+	if t.Before(minTemporal) || t.After(maxTemporal) {
+		return 0, outOfRange(definition, t.Format(time.RFC3339))
+	}
+	return t.UnixNano(), nil
+}
+
+// checkTemporalSegmentField ensures the values written to a temporal field are times unix nanoseconds can hold
+func checkTemporalSegmentField(definition *api.FieldDefinition, fieldType FieldType,
+	field *api.SegmentField) (*api.SegmentField, error) {
+	times := make([]time.Time, 0)
+	switch field.Value.(type) {
+	case *api.SegmentField_IntValue, *api.SegmentField_RepeatedIntValue:
+		seconds := []int64{field.GetIntValue().GetValue()}
+		if field.GetRepeatedIntValue() != nil {
+			seconds = field.GetRepeatedIntValue().Value
+		}
+		for _, value := range seconds {
+			t, err := unixTemporal(definition, value)
+			if err != nil {
+				return nil, err
+			}
+			times = append(times, t)
+		}
+	case *api.SegmentField_StringValue, *api.SegmentField_RepeatedStringValue:
+		values := []string{field.GetStringValue().GetValue()}
+		if field.GetRepeatedStringValue() != nil {
+			values = field.GetRepeatedStringValue().Value
+		}
+		for _, value := range values {
+			t, err := parseTemporal(definition, fieldType, value)
+			if err != nil {
+				return nil, err
+			}
+			times = append(times, t)
+		}
+	default:
+		return nil, typeMismatch(definition)
+	}
+
+	for _, t := range times {
+		if _, err := temporalNanos(definition, fieldType, t); err != nil {
+			return nil, err
+		}
+	}
+	return field, nil
+}
+
+// checkTemporalLookupField allows the lookups which only make sense for temporal fields, a RangeIntValue of unix
+// seconds finds timestamps between min and max, and a single time finds the timestamp ranges containing it
+func checkTemporalLookupField(definition *api.FieldDefinition, fieldType FieldType,
+	field *api.LookupField) (*api.LookupField, bool, error) {
+	if isTemporalScalar(definition, fieldType) {
+		if value, ok := field.Value.(*api.LookupField_RangeIntValue); ok {
+			_, err := temporalBetween(definition, fieldType, &api.LookupField{Value: value})
+			return field, true, err
+		}
+	}
+
+	if isTimestampRange(definition, fieldType) {
+		switch field.Value.(type) {
+		case *api.LookupField_IntValue, *api.LookupField_RepeatedIntValue:
+			return field, true, nil
+		case *api.LookupField_StringValue, *api.LookupField_RepeatedStringValue:
+			segmentField, _ := lookupToSegmentField(field)
+			if _, err := checkTemporalSegmentField(definition, fieldType, segmentField); err != nil {
+				return nil, true, err
+			}
+			return field, true, nil
+		}
+	}
+
+	return nil, false, nil
+}
+
+// isTemporalBetween reports whether a lookup asks for the timestamps between two times
+func isTemporalBetween(definition *api.FieldDefinition, fieldType FieldType, field *api.LookupField) bool {
+	_, ok := field.Value.(*api.LookupField_RangeIntValue)
+	return ok && isTemporalScalar(definition, fieldType)
+}
+
+// temporalBetween returns the inclusive greater or equal and exclusive less than pivots for a between lookup
+func temporalBetween(definition *api.FieldDefinition, fieldType FieldType, field *api.LookupField) (keyRange, error) {
+	value := field.GetRangeIntValue()
+	bounds := make([]int64, 0, 2)
+	for _, seconds := range []int64{value.Min, value.Max} {
+		t, err := unixTemporal(definition, seconds)
+		if err != nil {
+			return keyRange{}, err
+		}
+		nanos, err := temporalNanos(definition, fieldType, t)
+		if err != nil {
+			return keyRange{}, err
+		}
+		bounds = append(bounds, nanos)
+	}
+
+	// Bounds are whole seconds, so the nanosecond after the last can always be held
+	return keyRange{
+		greaterOrEqual: strconv.FormatInt(bounds[0], 10),
+		lessThan:       strconv.FormatInt(bounds[1]+1, 10),
+	}, nil
+}
+
+// marshallTemporal writes the values of a temporal field in their sortable form
+func (s *Stringer) marshallTemporal() error {
+	var field *api.SegmentField
+	if s.segmentField != nil {
+		field = s.segmentField
+	} else {
+		converted, ok := lookupToSegmentField(s.lookupField)
+		if !ok {
+			return ErrFieldUnknown
+		}
+		field = converted
+	}
+
+	seconds := make([]int64, 0)
+	switch field.Value.(type) {
+	case *api.SegmentField_IntValue:
+		seconds = append(seconds, field.GetIntValue().Value)
+	case *api.SegmentField_RepeatedIntValue:
+		seconds = append(seconds, field.GetRepeatedIntValue().Value...)
+	case *api.SegmentField_StringValue, *api.SegmentField_RepeatedStringValue:
+		values := []string{field.GetStringValue().GetValue()}
+		if field.GetRepeatedStringValue() != nil {
+			values = field.GetRepeatedStringValue().Value
+		}
+		for key, value := range values {
+			t, err := parseTemporal(s.fieldDefinition, s.fieldType, value)
+			if err != nil {
+				return err
+			}
+			if ok, err := s.fromTimeValue(key, t); err != nil || !ok {
+				return err
+			}
+		}
+		return nil
+	case *api.SegmentField_RangeIntValue, *api.SegmentField_RepeatedRangeIntValue:
+		// Timestamp ranges are already unix seconds
+		if s.segmentField != nil {
+			return s.marshallSegment()
+		}
+		return s.marshallLookup()
+	default:
+		return ErrFieldUnknown
+	}
+
+	for key, value := range seconds {
+		t, err := unixTemporal(s.fieldDefinition, value)
+		if err != nil {
+			return err
+		}
+		if ok, err := s.fromTimeValue(key, t); err != nil || !ok {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Stringer) fromTimeValue(key int, value time.Time) (bool, error) {
+	// A single time is looked up in a timestamp range as a range with no width
+	if isTimestampRange(s.fieldDefinition, s.fieldType) {
+		return s.fromRangeIntValue(key, &api.SegmentFieldRangeInt{Min: value.Unix(), Max: value.Unix()}), nil
+	}
+
+	nanos, err := temporalNanos(s.fieldDefinition, s.fieldType, value)
+	if err != nil {
+		return false, err
+	}
+	return s.iter(strconv.Itoa(key), strconv.FormatInt(nanos, 10)), nil
+}
+
+func (s *Stringer) toTemporalField(value string) (*api.SegmentField, error) {
+	nanos, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	layout := time.RFC3339Nano
+	if s.fieldType == FieldTypeDate {
+		layout = dateLayout
+	}
+
+	return &api.SegmentField{
+		Name: s.fieldDefinition.Name,
+		Value: &api.SegmentField_StringValue{
+			StringValue: &api.SegmentFieldString{
+				Value: time.Unix(0, nanos).UTC().Format(layout),
+			},
+		},
+	}, nil
+}
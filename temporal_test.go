@@ -0,0 +1,333 @@
+package db
+
+import (
+	"fmt"
+	api "github.com/segmentq/protos-api-go"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/iterator"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testCampaignIndex(t *testing.T, db *DB) *Index {
+	index, err := db.CreateIndexWithOptions(&api.IndexDefinition{
+		Name: "campaigns",
+		Fields: []*api.FieldDefinition{
+			{
+				Name:      "name",
+				DataType:  &api.FieldDefinition_Scalar{Scalar: api.ScalarType_DATA_TYPE_STRING},
+				IsPrimary: true,
+			},
+			scalarField("created", api.ScalarType_DATA_TYPE_INT64),
+			scalarField("launch", api.ScalarType_DATA_TYPE_INT64),
+			geoField("flight", api.GeoType_DATA_TYPE_RANGE_INT),
+		},
+	}, map[string]*FieldOptions{
+		"created": {Type: FieldTypeTimestamp},
+		"launch":  {Type: FieldTypeDate},
+		"flight":  {Type: FieldTypeTimestamp},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return index
+}
+
+func getCampaignSegment(name string, created *api.SegmentField, launch string, from, to time.Time) *api.Segment {
+	created.Name = "created"
+	return &api.Segment{
+		Fields: []*api.SegmentField{
+			{
+				Name:  "name",
+				Value: &api.SegmentField_StringValue{StringValue: &api.SegmentFieldString{Value: name}},
+			},
+			created,
+			{
+				Name:  "launch",
+				Value: &api.SegmentField_StringValue{StringValue: &api.SegmentFieldString{Value: launch}},
+			},
+			{
+				Name: "flight",
+				Value: &api.SegmentField_RangeIntValue{
+					RangeIntValue: &api.SegmentFieldRangeInt{Min: from.Unix(), Max: to.Unix()},
+				},
+			},
+		},
+	}
+}
+
+func testCollectKeys(t *testing.T, it *Iterator) []string {
+	collector := make([]string, 0)
+	for {
+		key, err := it.Next(nil)
+		if err == iterator.Done || err == ErrLookupEmpty {
+			break
+		}
+		if !assert.NoError(t, err) {
+			break
+		}
+		collector = append(collector, key)
+	}
+	return collector
+}
+
+func TestDB_Lookup_Temporal(t *testing.T) {
+	d := testNewDB(t)
+	index := testCampaignIndex(t, d)
+
+	jan := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	mar := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := index.InsertSegment(getCampaignSegment("winter", &api.SegmentField{
+		Value: &api.SegmentField_IntValue{IntValue: &api.SegmentFieldInt{Value: jan.Unix()}},
+	}, "2026-01-05", jan, feb))
+	assert.NoError(t, err)
+
+	_, err = index.InsertSegment(getCampaignSegment("spring", &api.SegmentField{
+		Value: &api.SegmentField_StringValue{StringValue: &api.SegmentFieldString{Value: "2026-02-10T12:30:00Z"}},
+	}, "2026-02-10", feb, mar))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		field *api.LookupField
+		want  []string
+	}{
+		{
+			name: "active window contains a time",
+			field: &api.LookupField{
+				Name:  "flight",
+				Value: &api.LookupField_IntValue{IntValue: &api.SegmentFieldInt{Value: jan.Add(240 * time.Hour).Unix()}},
+			},
+			want: []string{"winter"},
+		},
+		{
+			name: "active window contains an RFC 3339 time",
+			field: &api.LookupField{
+				Name:  "flight",
+				Value: &api.LookupField_StringValue{StringValue: &api.SegmentFieldString{Value: "2026-02-20T00:00:00Z"}},
+			},
+			want: []string{"spring"},
+		},
+		{
+			name: "created between",
+			field: &api.LookupField{
+				Name: "created",
+				Value: &api.LookupField_RangeIntValue{
+					RangeIntValue: &api.SegmentFieldRangeInt{Min: feb.Unix(), Max: mar.Unix()},
+				},
+			},
+			want: []string{"spring"},
+		},
+		{
+			name: "created at an exact time",
+			field: &api.LookupField{
+				Name:  "created",
+				Value: &api.LookupField_IntValue{IntValue: &api.SegmentFieldInt{Value: jan.Unix()}},
+			},
+			want: []string{"winter"},
+		},
+		{
+			name: "dates ignore the time of day",
+			field: &api.LookupField{
+				Name:  "launch",
+				Value: &api.LookupField_StringValue{StringValue: &api.SegmentFieldString{Value: "2026-01-05T18:00:00Z"}},
+			},
+			want: []string{"winter"},
+		},
+		{
+			name: "nothing created in the window",
+			field: &api.LookupField{
+				Name: "created",
+				Value: &api.LookupField_RangeIntValue{
+					RangeIntValue: &api.SegmentFieldRangeInt{Min: mar.Unix(), Max: mar.Add(time.Hour).Unix()},
+				},
+			},
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it, err := index.Lookup(&api.Lookup{Fields: []*api.LookupField{tt.field}})
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equalf(t, tt.want, testCollectKeys(t, it), fmt.Sprintf("Lookup(%v)", tt.field))
+		})
+	}
+}
+
+func TestIndex_InsertSegment_InvalidTimestamp(t *testing.T) {
+	d := testNewDB(t)
+	index := testCampaignIndex(t, d)
+
+	now := time.Now()
+	_, err := index.InsertSegment(getCampaignSegment("broken", &api.SegmentField{
+		Value: &api.SegmentField_StringValue{StringValue: &api.SegmentFieldString{Value: "yesterday"}},
+	}, "2026-01-05", now, now))
+	assert.ErrorIs(t, err, ErrTypeMismatch)
+	assert.Contains(t, err.Error(), "created")
+}
+
+func TestIndex_InsertSegment_TimestampOutOfRange(t *testing.T) {
+	d := testNewDB(t)
+	index := testCampaignIndex(t, d)
+
+	now := time.Now()
+	tests := []struct {
+		name    string
+		created *api.SegmentField
+	}{
+		{
+			name: "seconds after 2262",
+			created: &api.SegmentField{
+				Value: &api.SegmentField_IntValue{IntValue: &api.SegmentFieldInt{Value: 1 << 40}},
+			},
+		},
+		{
+			name: "RFC 3339 time before 1678",
+			created: &api.SegmentField{
+				Value: &api.SegmentField_StringValue{StringValue: &api.SegmentFieldString{Value: "1600-01-01T00:00:00Z"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := index.InsertSegment(getCampaignSegment("distant", tt.created, "2026-01-05", now, now))
+			assert.ErrorIs(t, err, ErrValueOutOfRange)
+		})
+	}
+
+	it, err := index.Lookup(&api.Lookup{Fields: []*api.LookupField{{
+		Name:  "created",
+		Value: &api.LookupField_RangeIntValue{RangeIntValue: &api.SegmentFieldRangeInt{Min: 0, Max: 1 << 40}},
+	}}})
+	if assert.NoError(t, err) {
+		_, err = it.Next(nil)
+		assert.ErrorIs(t, err, ErrValueOutOfRange)
+	}
+}
+
+func TestDB_CreateIndexWithOptions_TemporalType(t *testing.T) {
+	d := testNewDB(t)
+
+	tests := []struct {
+		name       string
+		definition *api.FieldDefinition
+		fieldType  FieldType
+		wantErr    error
+	}{
+		{name: "timestamp", definition: scalarField("created", api.ScalarType_DATA_TYPE_INT64), fieldType: FieldTypeTimestamp},
+		{name: "timestamp range", definition: geoField("flight", api.GeoType_DATA_TYPE_RANGE_INT), fieldType: FieldTypeTimestamp},
+		{name: "date", definition: scalarField("launch", api.ScalarType_DATA_TYPE_INT), fieldType: FieldTypeDate},
+		{
+			name:       "timestamp on a string",
+			definition: scalarField("created", api.ScalarType_DATA_TYPE_STRING),
+			fieldType:  FieldTypeTimestamp,
+			wantErr:    ErrInvalidFieldOptions,
+		},
+		{
+			name:       "date range",
+			definition: geoField("flight", api.GeoType_DATA_TYPE_RANGE_INT),
+			fieldType:  FieldTypeDate,
+			wantErr:    ErrInvalidFieldOptions,
+		},
+		{
+			name:       "unknown type",
+			definition: scalarField("created", api.ScalarType_DATA_TYPE_INT64),
+			fieldType:  "epoch",
+			wantErr:    ErrInvalidFieldOptions,
+		},
+	}
+	for n, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := d.CreateIndexWithOptions(&api.IndexDefinition{
+				Name: fmt.Sprintf("temporal-%d", n),
+				Fields: []*api.FieldDefinition{
+					{
+						Name:      "name",
+						DataType:  &api.FieldDefinition_Scalar{Scalar: api.ScalarType_DATA_TYPE_STRING},
+						IsPrimary: true,
+					},
+					tt.definition,
+				},
+			}, map[string]*FieldOptions{tt.definition.Name: {Type: tt.fieldType}})
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestNewDBWithConfig_TemporalReopened(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "segments.db")
+	d := testReopenDB(t, path, nil)
+
+	jan := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	index := testCampaignIndex(t, d)
+	_, err := index.InsertSegment(getCampaignSegment("winter", &api.SegmentField{
+		Value: &api.SegmentField_StringValue{StringValue: &api.SegmentFieldString{Value: "2026-01-01T00:00:00Z"}},
+	}, "2026-01-05", jan, jan.Add(24*time.Hour)))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	index, err = testReopenDB(t, path, d).GetIndexByName("campaigns")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	options, err := index.FieldOptions("launch")
+	if assert.NoError(t, err) {
+		assert.Equal(t, FieldTypeDate, options.Type)
+	}
+
+	it, err := index.Lookup(&api.Lookup{Fields: []*api.LookupField{{
+		Name:  "launch",
+		Value: &api.LookupField_StringValue{StringValue: &api.SegmentFieldString{Value: "2026-01-05T18:00:00Z"}},
+	}}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"winter"}, testCollectKeys(t, it))
+	}
+
+	primary, err := index.UnmarshallPrimaryValue("winter")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "winter", primary.GetStringValue().GetValue())
+	}
+}
+
+func TestStringer_toTemporalField(t *testing.T) {
+	tests := []struct {
+		name      string
+		fieldType FieldType
+		value     string
+		want      string
+	}{
+		{
+			name:      "timestamp",
+			fieldType: FieldTypeTimestamp,
+			value:     "1767225600000000001",
+			want:      "2026-01-01T00:00:00.000000001Z",
+		},
+		{
+			name:      "date",
+			fieldType: FieldTypeDate,
+			value:     "1767225600000000000",
+			want:      "2026-01-01",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			definition := scalarField("created", api.ScalarType_DATA_TYPE_INT64)
+			got, err := NewFieldDefinitionStringer(definition).withType(tt.fieldType).UnmarshallText(tt.value)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.want, got.GetStringValue().GetValue())
+		})
+	}
+}
@@ -0,0 +1,559 @@
+package db
+
+import (
+	"fmt"
+	api "github.com/segmentq/protos-api-go"
+	"math"
+)
+
+// intBounds holds the inclusive range of values a signed integer field can store
+var intBounds = map[api.ScalarType][2]int64{
+	api.ScalarType_DATA_TYPE_INT8:  {math.MinInt8, math.MaxInt8},
+	api.ScalarType_DATA_TYPE_INT16: {math.MinInt16, math.MaxInt16},
+	api.ScalarType_DATA_TYPE_INT32: {math.MinInt32, math.MaxInt32},
+}
+
+// uintBounds holds the largest value an unsigned integer field can store
+var uintBounds = map[api.ScalarType]uint64{
+	api.ScalarType_DATA_TYPE_UINT8:  math.MaxUint8,
+	api.ScalarType_DATA_TYPE_UINT16: math.MaxUint16,
+	api.ScalarType_DATA_TYPE_UINT32: math.MaxUint32,
+}
+
+// fieldTypeName describes the data type of a field for use in error messages, followed by its logical type
+func fieldTypeName(definition *api.FieldDefinition, fieldType FieldType) string {
+	name := "unknown"
+	switch definition.DataType.(type) {
+	case *api.FieldDefinition_Scalar:
+		name = definition.GetScalar().String()
+	case *api.FieldDefinition_Geo:
+		name = definition.GetGeo().String()
+	}
+
+	if fieldType != "" {
+		name += " " + string(fieldType)
+	}
+	return name
+}
+
+// typeMismatch and outOfRange name the data type holding the values of a field, which a value must match
+func typeMismatch(definition *api.FieldDefinition) error {
+	return fmt.Errorf("%w: field %q expects %s", ErrTypeMismatch, definition.Name, fieldTypeName(definition, ""))
+}
+
+func outOfRange(definition *api.FieldDefinition, value interface{}) error {
+	return fmt.Errorf("%w: field %q of %s cannot hold %v", ErrValueOutOfRange, definition.Name,
+		fieldTypeName(definition, ""), value)
+}
+
+// checkSegmentField ensures the value of a SegmentField can be stored in the field it is written to. When the
+// options coerce, lossless conversions (e.g. int to float) are applied and the converted SegmentField is returned.
+func checkSegmentField(definition *api.FieldDefinition, field *api.SegmentField,
+	options *FieldOptions) (*api.SegmentField, error) {
+	// Logical types are checked in place of the data type which holds their values
+	if isTemporalScalar(definition, options.fieldType()) {
+		return checkTemporalSegmentField(definition, options.fieldType(), field)
+	}
+	if isIPScalar(definition, options.fieldType()) || isCIDRRange(definition, options.fieldType()) {
+		return checkNetworkSegmentField(definition, options.fieldType(), field)
+	}
+	if isPathScalar(definition, options.fieldType()) {
+		return checkPathSegmentField(definition, field)
+	}
+
+	switch definition.DataType.(type) {
+	case *api.FieldDefinition_Scalar:
+		return checkScalarSegmentField(definition, field, options.coerce())
+	case *api.FieldDefinition_Geo:
+		return checkGeoSegmentField(definition, field, options.coerce())
+	}
+	return nil, ErrUnknownDataType
+}
+
+func checkScalarSegmentField(definition *api.FieldDefinition, field *api.SegmentField, coerce bool) (*api.SegmentField, error) {
+	scalar := definition.GetScalar()
+
+	switch scalar {
+	// STRINGs
+	case api.ScalarType_DATA_TYPE_UNDEFINED, api.ScalarType_DATA_TYPE_STRING:
+		switch field.Value.(type) {
+		case *api.SegmentField_StringValue, *api.SegmentField_RepeatedStringValue:
+			return field, nil
+		}
+	// BLOBs
+	case api.ScalarType_DATA_TYPE_BLOB:
+		switch field.Value.(type) {
+		case *api.SegmentField_BlobValue, *api.SegmentField_RepeatedBlobValue:
+			return field, nil
+		}
+	// INTs
+	case api.ScalarType_DATA_TYPE_INT, api.ScalarType_DATA_TYPE_INT8, api.ScalarType_DATA_TYPE_INT16,
+		api.ScalarType_DATA_TYPE_INT32, api.ScalarType_DATA_TYPE_INT64:
+		values, err := segmentIntValues(definition, field, coerce)
+		if err != nil {
+			return nil, err
+		}
+		if values == nil {
+			break
+		}
+		if err = checkIntValues(definition, values); err != nil {
+			return nil, err
+		}
+		if _, isInt := field.Value.(*api.SegmentField_IntValue); isInt || field.GetRepeatedIntValue() != nil {
+			return field, nil
+		}
+		return segmentFieldFromInts(field, values), nil
+	// UINTs
+	case api.ScalarType_DATA_TYPE_UINT, api.ScalarType_DATA_TYPE_UINT8, api.ScalarType_DATA_TYPE_UINT16,
+		api.ScalarType_DATA_TYPE_UINT32, api.ScalarType_DATA_TYPE_UINT64:
+		values, err := segmentUintValues(definition, field, coerce)
+		if err != nil {
+			return nil, err
+		}
+		if values == nil {
+			break
+		}
+		if err = checkUintValues(definition, values); err != nil {
+			return nil, err
+		}
+		if _, isUint := field.Value.(*api.SegmentField_UintValue); isUint || field.GetRepeatedUintValue() != nil {
+			return field, nil
+		}
+		return segmentFieldFromUints(field, values), nil
+	// FLOATs
+	case api.ScalarType_DATA_TYPE_FLOAT, api.ScalarType_DATA_TYPE_FLOAT32, api.ScalarType_DATA_TYPE_FLOAT64:
+		values, err := segmentFloatValues(definition, field, coerce)
+		if err != nil {
+			return nil, err
+		}
+		if values == nil {
+			break
+		}
+		if err = checkFloatValues(definition, values); err != nil {
+			return nil, err
+		}
+		if _, isFloat := field.Value.(*api.SegmentField_FloatValue); isFloat || field.GetRepeatedFloatValue() != nil {
+			return field, nil
+		}
+		return segmentFieldFromFloats(field, values), nil
+	// BOOL
+	case api.ScalarType_DATA_TYPE_BOOL:
+		switch field.Value.(type) {
+		case *api.SegmentField_BoolValue, *api.SegmentField_RepeatedBoolValue:
+			return field, nil
+		}
+	}
+
+	return nil, typeMismatch(definition)
+}
+
+func checkGeoSegmentField(definition *api.FieldDefinition, field *api.SegmentField, coerce bool) (*api.SegmentField, error) {
+	switch definition.GetGeo() {
+	// RANGEs
+	case api.GeoType_DATA_TYPE_RANGE:
+		switch field.Value.(type) {
+		case *api.SegmentField_RangeIntValue, *api.SegmentField_RepeatedRangeIntValue,
+			*api.SegmentField_RangeFloatValue, *api.SegmentField_RepeatedRangeFloatValue:
+			return field, nil
+		}
+	case api.GeoType_DATA_TYPE_RANGE_INT:
+		switch field.Value.(type) {
+		case *api.SegmentField_RangeIntValue, *api.SegmentField_RepeatedRangeIntValue:
+			return field, nil
+		}
+	case api.GeoType_DATA_TYPE_RANGE_FLOAT:
+		switch field.Value.(type) {
+		case *api.SegmentField_RangeFloatValue, *api.SegmentField_RepeatedRangeFloatValue:
+			return field, nil
+		case *api.SegmentField_RangeIntValue:
+			if coerce {
+				return &api.SegmentField{
+					Name:  field.Name,
+					Value: &api.SegmentField_RangeFloatValue{RangeFloatValue: rangeIntToFloat(field.GetRangeIntValue())},
+				}, nil
+			}
+		case *api.SegmentField_RepeatedRangeIntValue:
+			if coerce {
+				values := make([]*api.SegmentFieldRangeFloat, 0, len(field.GetRepeatedRangeIntValue().Value))
+				for _, value := range field.GetRepeatedRangeIntValue().Value {
+					values = append(values, rangeIntToFloat(value))
+				}
+				return &api.SegmentField{
+					Name: field.Name,
+					Value: &api.SegmentField_RepeatedRangeFloatValue{
+						RepeatedRangeFloatValue: &api.SegmentFieldRepeatedRangeFloat{Value: values},
+					},
+				}, nil
+			}
+		}
+	// GEOs
+	case api.GeoType_DATA_TYPE_GEO:
+		switch field.Value.(type) {
+		case *api.SegmentField_GeoPointValue, *api.SegmentField_RepeatedGeoPointValue,
+			*api.SegmentField_GeoRectValue, *api.SegmentField_RepeatedGeoRectValue:
+			return field, nil
+		}
+	case api.GeoType_DATA_TYPE_GEO_POINT:
+		switch field.Value.(type) {
+		case *api.SegmentField_GeoPointValue, *api.SegmentField_RepeatedGeoPointValue:
+			return field, nil
+		}
+	case api.GeoType_DATA_TYPE_GEO_RECT:
+		switch field.Value.(type) {
+		case *api.SegmentField_GeoRectValue, *api.SegmentField_RepeatedGeoRectValue:
+			return field, nil
+		}
+	}
+
+	return nil, typeMismatch(definition)
+}
+
+// checkLookupField ensures a LookupField can be compared with the values stored in the field. Lookups are converted
+// to a SegmentField so the same rules apply as when the value was written.
+func checkLookupField(definition *api.FieldDefinition, field *api.LookupField,
+	options *FieldOptions) (*api.LookupField, error) {
+	// Lookups have no blob value, the raw bytes of a BLOB are looked up as a string
+	if _, ok := definition.DataType.(*api.FieldDefinition_Scalar); ok && definition.GetScalar() == api.ScalarType_DATA_TYPE_BLOB {
+		switch field.Value.(type) {
+		case *api.LookupField_StringValue, *api.LookupField_RepeatedStringValue:
+			return field, nil
+		}
+		return nil, typeMismatch(definition)
+	}
+
+	if checked, ok, err := checkTemporalLookupField(definition, options.fieldType(), field); ok {
+		return checked, err
+	}
+
+	if checked, ok, err := checkNetworkLookupField(definition, options.fieldType(), field); ok {
+		return checked, err
+	}
+
+	segmentField, ok := lookupToSegmentField(field)
+	if !ok {
+		return nil, typeMismatch(definition)
+	}
+
+	checked, err := checkSegmentField(definition, segmentField, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if checked == segmentField {
+		return field, nil
+	}
+
+	converted, ok := segmentToLookupField(checked)
+	if !ok {
+		return nil, typeMismatch(definition)
+	}
+
+	return converted, nil
+}
+
+func segmentIntValues(definition *api.FieldDefinition, field *api.SegmentField, coerce bool) ([]int64, error) {
+	switch field.Value.(type) {
+	case *api.SegmentField_IntValue:
+		return []int64{field.GetIntValue().Value}, nil
+	case *api.SegmentField_RepeatedIntValue:
+		return append([]int64{}, field.GetRepeatedIntValue().Value...), nil
+	case *api.SegmentField_UintValue, *api.SegmentField_RepeatedUintValue:
+		if !coerce {
+			return nil, nil
+		}
+		uints := []uint64{field.GetUintValue().GetValue()}
+		if field.GetRepeatedUintValue() != nil {
+			uints = field.GetRepeatedUintValue().Value
+		}
+		values := make([]int64, 0, len(uints))
+		for _, value := range uints {
+			if value > math.MaxInt64 {
+				return nil, outOfRange(definition, value)
+			}
+			values = append(values, int64(value))
+		}
+		return values, nil
+	}
+	return nil, nil
+}
+
+func segmentUintValues(definition *api.FieldDefinition, field *api.SegmentField, coerce bool) ([]uint64, error) {
+	switch field.Value.(type) {
+	case *api.SegmentField_UintValue:
+		return []uint64{field.GetUintValue().Value}, nil
+	case *api.SegmentField_RepeatedUintValue:
+		return field.GetRepeatedUintValue().Value, nil
+	case *api.SegmentField_IntValue, *api.SegmentField_RepeatedIntValue:
+		if !coerce {
+			return nil, nil
+		}
+		ints := []int64{field.GetIntValue().GetValue()}
+		if field.GetRepeatedIntValue() != nil {
+			ints = field.GetRepeatedIntValue().Value
+		}
+		values := make([]uint64, 0, len(ints))
+		for _, value := range ints {
+			if value < 0 {
+				return nil, outOfRange(definition, value)
+			}
+			values = append(values, uint64(value))
+		}
+		return values, nil
+	}
+	return nil, nil
+}
+
+// maxExactFloat is the magnitude above which not every integer has a float64 of its own, coercing larger ints
+// would round them
+const maxExactFloat = 1 << 53
+
+func segmentFloatValues(definition *api.FieldDefinition, field *api.SegmentField, coerce bool) ([]float64, error) {
+	switch field.Value.(type) {
+	case *api.SegmentField_FloatValue:
+		return []float64{field.GetFloatValue().Value}, nil
+	case *api.SegmentField_RepeatedFloatValue:
+		return append([]float64{}, field.GetRepeatedFloatValue().Value...), nil
+	case *api.SegmentField_IntValue, *api.SegmentField_RepeatedIntValue:
+		if !coerce {
+			return nil, nil
+		}
+		ints := []int64{field.GetIntValue().GetValue()}
+		if field.GetRepeatedIntValue() != nil {
+			ints = field.GetRepeatedIntValue().Value
+		}
+		values := make([]float64, 0, len(ints))
+		for _, value := range ints {
+			if value > maxExactFloat || value < -maxExactFloat {
+				return nil, outOfRange(definition, value)
+			}
+			values = append(values, float64(value))
+		}
+		return values, nil
+	case *api.SegmentField_UintValue, *api.SegmentField_RepeatedUintValue:
+		if !coerce {
+			return nil, nil
+		}
+		uints := []uint64{field.GetUintValue().GetValue()}
+		if field.GetRepeatedUintValue() != nil {
+			uints = field.GetRepeatedUintValue().Value
+		}
+		values := make([]float64, 0, len(uints))
+		for _, value := range uints {
+			if value > maxExactFloat {
+				return nil, outOfRange(definition, value)
+			}
+			values = append(values, float64(value))
+		}
+		return values, nil
+	}
+	return nil, nil
+}
+
+func checkIntValues(definition *api.FieldDefinition, values []int64) error {
+	bounds, ok := intBounds[definition.GetScalar()]
+	if !ok {
+		return nil
+	}
+
+	for _, value := range values {
+		if value < bounds[0] || value > bounds[1] {
+			return outOfRange(definition, value)
+		}
+	}
+	return nil
+}
+
+func checkUintValues(definition *api.FieldDefinition, values []uint64) error {
+	bound, ok := uintBounds[definition.GetScalar()]
+	if !ok {
+		return nil
+	}
+
+	for _, value := range values {
+		if value > bound {
+			return outOfRange(definition, value)
+		}
+	}
+	return nil
+}
+
+func checkFloatValues(definition *api.FieldDefinition, values []float64) error {
+	if definition.GetScalar() != api.ScalarType_DATA_TYPE_FLOAT32 {
+		return nil
+	}
+
+	for _, value := range values {
+		if math.Abs(value) > math.MaxFloat32 && !math.IsInf(value, 0) {
+			return outOfRange(definition, value)
+		}
+	}
+	return nil
+}
+
+// segmentFieldFromInts builds a SegmentField of ints keeping the repeated-ness of the original field
+func segmentFieldFromInts(field *api.SegmentField, values []int64) *api.SegmentField {
+	if isRepeatedSegmentField(field) {
+		return &api.SegmentField{
+			Name:  field.Name,
+			Value: &api.SegmentField_RepeatedIntValue{RepeatedIntValue: &api.SegmentFieldRepeatedInt{Value: values}},
+		}
+	}
+	return &api.SegmentField{
+		Name:  field.Name,
+		Value: &api.SegmentField_IntValue{IntValue: &api.SegmentFieldInt{Value: values[0]}},
+	}
+}
+
+// segmentFieldFromUints builds a SegmentField of uints keeping the repeated-ness of the original field
+func segmentFieldFromUints(field *api.SegmentField, values []uint64) *api.SegmentField {
+	if isRepeatedSegmentField(field) {
+		return &api.SegmentField{
+			Name:  field.Name,
+			Value: &api.SegmentField_RepeatedUintValue{RepeatedUintValue: &api.SegmentFieldRepeatedUInt{Value: values}},
+		}
+	}
+	return &api.SegmentField{
+		Name:  field.Name,
+		Value: &api.SegmentField_UintValue{UintValue: &api.SegmentFieldUInt{Value: values[0]}},
+	}
+}
+
+// segmentFieldFromFloats builds a SegmentField of floats keeping the repeated-ness of the original field
+func segmentFieldFromFloats(field *api.SegmentField, values []float64) *api.SegmentField {
+	if isRepeatedSegmentField(field) {
+		return &api.SegmentField{
+			Name: field.Name,
+			Value: &api.SegmentField_RepeatedFloatValue{
+				RepeatedFloatValue: &api.SegmentFieldRepeatedFloat{Value: values},
+			},
+		}
+	}
+	return &api.SegmentField{
+		Name:  field.Name,
+		Value: &api.SegmentField_FloatValue{FloatValue: &api.SegmentFieldFloat{Value: values[0]}},
+	}
+}
+
+func rangeIntToFloat(value *api.SegmentFieldRangeInt) *api.SegmentFieldRangeFloat {
+	return &api.SegmentFieldRangeFloat{
+		Min: float64(value.GetMin()),
+		Max: float64(value.GetMax()),
+	}
+}
+
+func isRepeatedSegmentField(field *api.SegmentField) bool {
+	switch field.Value.(type) {
+	case *api.SegmentField_RepeatedStringValue,
+		*api.SegmentField_RepeatedIntValue,
+		*api.SegmentField_RepeatedUintValue,
+		*api.SegmentField_RepeatedFloatValue,
+		*api.SegmentField_RepeatedBoolValue,
+		*api.SegmentField_RepeatedBlobValue,
+		*api.SegmentField_RepeatedRangeIntValue,
+		*api.SegmentField_RepeatedRangeFloatValue,
+		*api.SegmentField_RepeatedGeoPointValue,
+		*api.SegmentField_RepeatedGeoRectValue:
+		return true
+	}
+	return false
+}
+
+// lookupToSegmentField maps the value of a LookupField to the matching SegmentField value
+func lookupToSegmentField(field *api.LookupField) (*api.SegmentField, bool) {
+	segmentField := &api.SegmentField{Name: field.Name}
+
+	switch v := field.Value.(type) {
+	case *api.LookupField_StringValue:
+		segmentField.Value = &api.SegmentField_StringValue{StringValue: v.StringValue}
+	case *api.LookupField_RepeatedStringValue:
+		segmentField.Value = &api.SegmentField_RepeatedStringValue{RepeatedStringValue: v.RepeatedStringValue}
+	case *api.LookupField_IntValue:
+		segmentField.Value = &api.SegmentField_IntValue{IntValue: v.IntValue}
+	case *api.LookupField_RepeatedIntValue:
+		segmentField.Value = &api.SegmentField_RepeatedIntValue{RepeatedIntValue: v.RepeatedIntValue}
+	case *api.LookupField_UintValue:
+		segmentField.Value = &api.SegmentField_UintValue{UintValue: v.UintValue}
+	case *api.LookupField_RepeatedUintValue:
+		segmentField.Value = &api.SegmentField_RepeatedUintValue{RepeatedUintValue: v.RepeatedUintValue}
+	case *api.LookupField_FloatValue:
+		segmentField.Value = &api.SegmentField_FloatValue{FloatValue: v.FloatValue}
+	case *api.LookupField_RepeatedFloatValue:
+		segmentField.Value = &api.SegmentField_RepeatedFloatValue{RepeatedFloatValue: v.RepeatedFloatValue}
+	case *api.LookupField_BoolValue:
+		segmentField.Value = &api.SegmentField_BoolValue{BoolValue: v.BoolValue}
+	case *api.LookupField_RepeatedBoolValue:
+		segmentField.Value = &api.SegmentField_RepeatedBoolValue{RepeatedBoolValue: v.RepeatedBoolValue}
+	case *api.LookupField_RangeIntValue:
+		segmentField.Value = &api.SegmentField_RangeIntValue{RangeIntValue: v.RangeIntValue}
+	case *api.LookupField_RepeatedRangeIntValue:
+		segmentField.Value = &api.SegmentField_RepeatedRangeIntValue{RepeatedRangeIntValue: v.RepeatedRangeIntValue}
+	case *api.LookupField_RangeFloatValue:
+		segmentField.Value = &api.SegmentField_RangeFloatValue{RangeFloatValue: v.RangeFloatValue}
+	case *api.LookupField_RepeatedRangeFloatValue:
+		segmentField.Value = &api.SegmentField_RepeatedRangeFloatValue{
+			RepeatedRangeFloatValue: v.RepeatedRangeFloatValue,
+		}
+	case *api.LookupField_GeoPointValue:
+		segmentField.Value = &api.SegmentField_GeoPointValue{GeoPointValue: v.GeoPointValue}
+	case *api.LookupField_RepeatedGeoPointValue:
+		segmentField.Value = &api.SegmentField_RepeatedGeoPointValue{RepeatedGeoPointValue: v.RepeatedGeoPointValue}
+	case *api.LookupField_GeoRectValue:
+		segmentField.Value = &api.SegmentField_GeoRectValue{GeoRectValue: v.GeoRectValue}
+	case *api.LookupField_RepeatedGeoRectValue:
+		segmentField.Value = &api.SegmentField_RepeatedGeoRectValue{RepeatedGeoRectValue: v.RepeatedGeoRectValue}
+	default:
+		return nil, false
+	}
+
+	return segmentField, true
+}
+
+// segmentToLookupField maps the value of a SegmentField back to a LookupField, BLOBs have no lookup equivalent
+func segmentToLookupField(field *api.SegmentField) (*api.LookupField, bool) {
+	lookupField := &api.LookupField{Name: field.Name}
+
+	switch v := field.Value.(type) {
+	case *api.SegmentField_StringValue:
+		lookupField.Value = &api.LookupField_StringValue{StringValue: v.StringValue}
+	case *api.SegmentField_RepeatedStringValue:
+		lookupField.Value = &api.LookupField_RepeatedStringValue{RepeatedStringValue: v.RepeatedStringValue}
+	case *api.SegmentField_IntValue:
+		lookupField.Value = &api.LookupField_IntValue{IntValue: v.IntValue}
+	case *api.SegmentField_RepeatedIntValue:
+		lookupField.Value = &api.LookupField_RepeatedIntValue{RepeatedIntValue: v.RepeatedIntValue}
+	case *api.SegmentField_UintValue:
+		lookupField.Value = &api.LookupField_UintValue{UintValue: v.UintValue}
+	case *api.SegmentField_RepeatedUintValue:
+		lookupField.Value = &api.LookupField_RepeatedUintValue{RepeatedUintValue: v.RepeatedUintValue}
+	case *api.SegmentField_FloatValue:
+		lookupField.Value = &api.LookupField_FloatValue{FloatValue: v.FloatValue}
+	case *api.SegmentField_RepeatedFloatValue:
+		lookupField.Value = &api.LookupField_RepeatedFloatValue{RepeatedFloatValue: v.RepeatedFloatValue}
+	case *api.SegmentField_BoolValue:
+		lookupField.Value = &api.LookupField_BoolValue{BoolValue: v.BoolValue}
+	case *api.SegmentField_RepeatedBoolValue:
+		lookupField.Value = &api.LookupField_RepeatedBoolValue{RepeatedBoolValue: v.RepeatedBoolValue}
+	case *api.SegmentField_RangeIntValue:
+		lookupField.Value = &api.LookupField_RangeIntValue{RangeIntValue: v.RangeIntValue}
+	case *api.SegmentField_RepeatedRangeIntValue:
+		lookupField.Value = &api.LookupField_RepeatedRangeIntValue{RepeatedRangeIntValue: v.RepeatedRangeIntValue}
+	case *api.SegmentField_RangeFloatValue:
+		lookupField.Value = &api.LookupField_RangeFloatValue{RangeFloatValue: v.RangeFloatValue}
+	case *api.SegmentField_RepeatedRangeFloatValue:
+		lookupField.Value = &api.LookupField_RepeatedRangeFloatValue{
+			RepeatedRangeFloatValue: v.RepeatedRangeFloatValue,
+		}
+	case *api.SegmentField_GeoPointValue:
+		lookupField.Value = &api.LookupField_GeoPointValue{GeoPointValue: v.GeoPointValue}
+	case *api.SegmentField_RepeatedGeoPointValue:
+		lookupField.Value = &api.LookupField_RepeatedGeoPointValue{RepeatedGeoPointValue: v.RepeatedGeoPointValue}
+	case *api.SegmentField_GeoRectValue:
+		lookupField.Value = &api.LookupField_GeoRectValue{GeoRectValue: v.GeoRectValue}
+	case *api.SegmentField_RepeatedGeoRectValue:
+		lookupField.Value = &api.LookupField_RepeatedGeoRectValue{RepeatedGeoRectValue: v.RepeatedGeoRectValue}
+	default:
+		return nil, false
+	}
+
+	return lookupField, true
+}
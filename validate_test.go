@@ -0,0 +1,297 @@
+package db
+
+import (
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	api "github.com/segmentq/protos-api-go"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func scalarField(name string, scalar api.ScalarType) *api.FieldDefinition {
+	return &api.FieldDefinition{Name: name, DataType: &api.FieldDefinition_Scalar{Scalar: scalar}}
+}
+
+func geoField(name string, geo api.GeoType) *api.FieldDefinition {
+	return &api.FieldDefinition{Name: name, DataType: &api.FieldDefinition_Geo{Geo: geo}}
+}
+
+func intSegmentField(name string, value int64) *api.SegmentField {
+	return &api.SegmentField{
+		Name:  name,
+		Value: &api.SegmentField_IntValue{IntValue: &api.SegmentFieldInt{Value: value}},
+	}
+}
+
+func Test_checkSegmentField(t *testing.T) {
+	type args struct {
+		definition *api.FieldDefinition
+		field      *api.SegmentField
+		coerce     bool
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    *api.SegmentField
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{
+			name: "string in string field",
+			args: args{
+				definition: scalarField("name", api.ScalarType_DATA_TYPE_STRING),
+				field:      getSingleFieldSegment("banana").Fields[0],
+			},
+			want:    getSingleFieldSegment("banana").Fields[0],
+			wantErr: assert.NoError,
+		},
+		{
+			name: "string in int field",
+			args: args{
+				definition: scalarField("name", api.ScalarType_DATA_TYPE_INT),
+				field:      getSingleFieldSegment("banana").Fields[0],
+			},
+			wantErr: assert.Error,
+		},
+		{
+			name: "int in int8 field",
+			args: args{
+				definition: scalarField("age", api.ScalarType_DATA_TYPE_INT8),
+				field:      intSegmentField("age", 127),
+			},
+			want:    intSegmentField("age", 127),
+			wantErr: assert.NoError,
+		},
+		{
+			name: "int out of range for int8 field",
+			args: args{
+				definition: scalarField("age", api.ScalarType_DATA_TYPE_INT8),
+				field:      intSegmentField("age", 128),
+			},
+			wantErr: assert.Error,
+		},
+		{
+			name: "int in float field without coercion",
+			args: args{
+				definition: scalarField("bid", api.ScalarType_DATA_TYPE_FLOAT),
+				field:      intSegmentField("bid", 2),
+			},
+			wantErr: assert.Error,
+		},
+		{
+			name: "int in float field with coercion",
+			args: args{
+				definition: scalarField("bid", api.ScalarType_DATA_TYPE_FLOAT),
+				field:      intSegmentField("bid", 2),
+				coerce:     true,
+			},
+			want: &api.SegmentField{
+				Name:  "bid",
+				Value: &api.SegmentField_FloatValue{FloatValue: &api.SegmentFieldFloat{Value: 2}},
+			},
+			wantErr: assert.NoError,
+		},
+		{
+			name: "int above 2^53 in float field with coercion",
+			args: args{
+				definition: scalarField("bid", api.ScalarType_DATA_TYPE_FLOAT),
+				field:      intSegmentField("bid", 1<<53+1),
+				coerce:     true,
+			},
+			wantErr: func(t assert.TestingT, err error, msgAndArgs ...interface{}) bool {
+				return assert.ErrorIs(t, err, ErrValueOutOfRange, msgAndArgs...)
+			},
+		},
+		{
+			name: "uint above 2^53 in float field with coercion",
+			args: args{
+				definition: scalarField("bid", api.ScalarType_DATA_TYPE_FLOAT64),
+				field: &api.SegmentField{
+					Name:  "bid",
+					Value: &api.SegmentField_UintValue{UintValue: &api.SegmentFieldUInt{Value: 1<<53 + 1}},
+				},
+				coerce: true,
+			},
+			wantErr: func(t assert.TestingT, err error, msgAndArgs ...interface{}) bool {
+				return assert.ErrorIs(t, err, ErrValueOutOfRange, msgAndArgs...)
+			},
+		},
+		{
+			name: "negative int in uint field with coercion",
+			args: args{
+				definition: scalarField("count", api.ScalarType_DATA_TYPE_UINT8),
+				field:      intSegmentField("count", -1),
+				coerce:     true,
+			},
+			wantErr: assert.Error,
+		},
+		{
+			name: "int in uint8 field with coercion",
+			args: args{
+				definition: scalarField("count", api.ScalarType_DATA_TYPE_UINT8),
+				field:      intSegmentField("count", 255),
+				coerce:     true,
+			},
+			want: &api.SegmentField{
+				Name:  "count",
+				Value: &api.SegmentField_UintValue{UintValue: &api.SegmentFieldUInt{Value: 255}},
+			},
+			wantErr: assert.NoError,
+		},
+		{
+			name: "uint above max int64 in int field with coercion",
+			args: args{
+				definition: scalarField("count", api.ScalarType_DATA_TYPE_INT64),
+				field: &api.SegmentField{
+					Name:  "count",
+					Value: &api.SegmentField_UintValue{UintValue: &api.SegmentFieldUInt{Value: math.MaxInt64 + 1}},
+				},
+				coerce: true,
+			},
+			wantErr: func(t assert.TestingT, err error, msgAndArgs ...interface{}) bool {
+				return assert.ErrorIs(t, err, ErrValueOutOfRange, msgAndArgs...)
+			},
+		},
+		{
+			name: "range int in range field",
+			args: args{
+				definition: geoField("age", api.GeoType_DATA_TYPE_RANGE),
+				field: &api.SegmentField{
+					Name:  "age",
+					Value: &api.SegmentField_RangeIntValue{RangeIntValue: &api.SegmentFieldRangeInt{Min: 1, Max: 2}},
+				},
+			},
+			want: &api.SegmentField{
+				Name:  "age",
+				Value: &api.SegmentField_RangeIntValue{RangeIntValue: &api.SegmentFieldRangeInt{Min: 1, Max: 2}},
+			},
+			wantErr: assert.NoError,
+		},
+		{
+			name: "int in range field",
+			args: args{
+				definition: geoField("age", api.GeoType_DATA_TYPE_RANGE),
+				field:      intSegmentField("age", 2),
+				coerce:     true,
+			},
+			wantErr: assert.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkSegmentField(tt.args.definition, tt.args.field, &FieldOptions{Coerce: tt.args.coerce})
+			if !tt.wantErr(t, err, fmt.Sprintf("checkSegmentField(%v, %v, %v)", tt.args.definition, tt.args.field, tt.args.coerce)) {
+				return
+			}
+			assert.Truef(t, proto.Equal(tt.want, got), "checkSegmentField(%v, %v, %v)", tt.args.definition, tt.args.field, tt.args.coerce)
+		})
+	}
+}
+
+func Test_checkLookupField(t *testing.T) {
+	type args struct {
+		definition *api.FieldDefinition
+		field      *api.LookupField
+		coerce     bool
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    *api.LookupField
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{
+			name: "string lookup on string field",
+			args: args{
+				definition: scalarField("name", api.ScalarType_DATA_TYPE_STRING),
+				field: &api.LookupField{
+					Name:  "name",
+					Value: &api.LookupField_StringValue{StringValue: &api.SegmentFieldString{Value: "banana"}},
+				},
+			},
+			want: &api.LookupField{
+				Name:  "name",
+				Value: &api.LookupField_StringValue{StringValue: &api.SegmentFieldString{Value: "banana"}},
+			},
+			wantErr: assert.NoError,
+		},
+		{
+			name: "string lookup on int field",
+			args: args{
+				definition: scalarField("age", api.ScalarType_DATA_TYPE_INT),
+				field: &api.LookupField{
+					Name:  "age",
+					Value: &api.LookupField_StringValue{StringValue: &api.SegmentFieldString{Value: "banana"}},
+				},
+			},
+			wantErr: assert.Error,
+		},
+		{
+			name: "int lookup on float field with coercion",
+			args: args{
+				definition: scalarField("bid", api.ScalarType_DATA_TYPE_FLOAT),
+				field: &api.LookupField{
+					Name:  "bid",
+					Value: &api.LookupField_IntValue{IntValue: &api.SegmentFieldInt{Value: 3}},
+				},
+				coerce: true,
+			},
+			want: &api.LookupField{
+				Name:  "bid",
+				Value: &api.LookupField_FloatValue{FloatValue: &api.SegmentFieldFloat{Value: 3}},
+			},
+			wantErr: assert.NoError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkLookupField(tt.args.definition, tt.args.field, &FieldOptions{Coerce: tt.args.coerce})
+			if !tt.wantErr(t, err, fmt.Sprintf("checkLookupField(%v, %v, %v)", tt.args.definition, tt.args.field, tt.args.coerce)) {
+				return
+			}
+			assert.Truef(t, proto.Equal(tt.want, got), "checkLookupField(%v, %v, %v)", tt.args.definition, tt.args.field, tt.args.coerce)
+		})
+	}
+}
+
+func TestIndex_InsertSegment_TypeMismatch(t *testing.T) {
+	d := testNewDB(t)
+	index, err := d.CreateIndex(&api.IndexDefinition{
+		Name: "bids",
+		Fields: []*api.FieldDefinition{
+			{
+				Name:      "name",
+				DataType:  &api.FieldDefinition_Scalar{Scalar: api.ScalarType_DATA_TYPE_STRING},
+				IsPrimary: true,
+			},
+			scalarField("min_bid", api.ScalarType_DATA_TYPE_INT),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	segment := getSingleFieldSegment("banana")
+	segment.Fields = append(segment.Fields, &api.SegmentField{
+		Name:  "min_bid",
+		Value: &api.SegmentField_StringValue{StringValue: &api.SegmentFieldString{Value: "two"}},
+	})
+
+	_, err = index.InsertSegment(segment)
+	assert.ErrorIs(t, err, ErrTypeMismatch)
+	assert.Contains(t, err.Error(), "min_bid")
+	assert.Contains(t, err.Error(), "DATA_TYPE_INT")
+
+	it, err := index.Lookup(&api.Lookup{
+		Fields: []*api.LookupField{
+			{
+				Name:  "min_bid",
+				Value: &api.LookupField_StringValue{StringValue: &api.SegmentFieldString{Value: "two"}},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	_, err = it.Next(nil)
+	assert.ErrorIs(t, err, ErrTypeMismatch)
+}